@@ -0,0 +1,156 @@
+package snowflake
+
+import (
+	"database/sql/driver"
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/snowflakedb/gosnowflake"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// arrayBindThreshold returns the number of rows from which Create binds one array per column, 0 when disabled
+func arrayBindThreshold(db *gorm.DB) int {
+	if config := configOf(db); config != nil && config.ArrayBindThreshold > 0 {
+		return config.ArrayBindThreshold
+	}
+	return 0
+}
+
+// arrayBindValues turns the rows of values into a single row holding one gosnowflake.Array per column. It reports
+// false when a value can't be array bound, e.g. NULL, an SQL expression or a column type DataTypeOf doesn't map,
+// and the rows are inserted as a VALUES list instead.
+func arrayBindValues(stmt *gorm.Statement, values clause.Values) (clause.Values, bool) {
+	if stmt.Schema == nil || len(values.Columns) == 0 {
+		return values, false
+	}
+
+	binds := make([]interface{}, len(values.Columns))
+	for idx, column := range values.Columns {
+		field := stmt.Schema.LookUpField(column.Name)
+		if field == nil {
+			return values, false
+		}
+
+		bind, ok := arrayBindColumn(field, values.Values, idx)
+		if !ok {
+			return values, false
+		}
+		binds[idx] = bind
+	}
+
+	return clause.Values{Columns: values.Columns, Values: [][]interface{}{binds}}, true
+}
+
+func arrayBindColumn(field *schema.Field, rows [][]interface{}, idx int) (interface{}, bool) {
+	var (
+		bools   []bool
+		ints    []int64
+		floats  []float64
+		strings []string
+		times   []time.Time
+		bytes   [][]byte
+	)
+
+	for _, row := range rows {
+		value, ok := arrayBindValue(row[idx])
+		if !ok {
+			return nil, false
+		}
+
+		switch field.DataType {
+		case schema.Bool:
+			if value.Kind() != reflect.Bool {
+				return nil, false
+			}
+			bools = append(bools, value.Bool())
+		case schema.Int, schema.Uint:
+			switch value.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				ints = append(ints, value.Int())
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				if value.Uint() > math.MaxInt64 {
+					return nil, false
+				}
+				ints = append(ints, int64(value.Uint()))
+			default:
+				return nil, false
+			}
+		case schema.Float:
+			switch value.Kind() {
+			case reflect.Float32, reflect.Float64:
+				floats = append(floats, value.Float())
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				floats = append(floats, float64(value.Int()))
+			default:
+				return nil, false
+			}
+		case schema.String:
+			if value.Kind() != reflect.String {
+				return nil, false
+			}
+			strings = append(strings, value.String())
+		case schema.Time:
+			t, ok := value.Interface().(time.Time)
+			if !ok {
+				return nil, false
+			}
+			times = append(times, t)
+		case schema.Bytes:
+			if value.Kind() != reflect.Slice || value.Type().Elem().Kind() != reflect.Uint8 {
+				return nil, false
+			}
+			bytes = append(bytes, value.Bytes())
+		default:
+			return nil, false
+		}
+	}
+
+	switch field.DataType {
+	case schema.Bool:
+		return gosnowflake.Array(bools), true
+	case schema.Int, schema.Uint:
+		return gosnowflake.Array(ints), true
+	case schema.Float:
+		return gosnowflake.Array(floats), true
+	case schema.String:
+		return gosnowflake.Array(strings), true
+	case schema.Time:
+		// DataTypeOf creates time fields as TIMESTAMP_NTZ
+		return gosnowflake.Array(times, gosnowflake.TimestampNTZType), true
+	case schema.Bytes:
+		return gosnowflake.Array(bytes), true
+	}
+	return nil, false
+}
+
+// arrayBindValue resolves valuers and pointers, NULL and SQL expressions can't be part of an array
+func arrayBindValue(value interface{}) (reflect.Value, bool) {
+	if valuer, ok := value.(driver.Valuer); ok {
+		if rv := reflect.ValueOf(valuer); rv.Kind() == reflect.Pointer && rv.IsNil() {
+			return reflect.Value{}, false
+		}
+		resolved, err := valuer.Value()
+		if err != nil {
+			return reflect.Value{}, false
+		}
+		value = resolved
+	}
+
+	switch value.(type) {
+	case nil, clause.Expression, gorm.Valuer:
+		return reflect.Value{}, false
+	}
+
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return reflect.Value{}, false
+		}
+		rv = rv.Elem()
+	}
+	return rv, true
+}
@@ -0,0 +1,99 @@
+package snowflake_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/snowflakedb/gosnowflake"
+	"github.com/stretchr/testify/require"
+	snowflake "github.com/vonix/gorm-snowflake"
+	"gorm.io/gorm"
+)
+
+type Reading struct {
+	ID       uint
+	Sensor   string
+	Value    float64
+	Count    int32
+	Valid    bool
+	Raw      []byte
+	TakenAt  time.Time
+	Comment  *string
+	Revision uint16
+}
+
+func openArrayBind(t *testing.T, threshold int) (*gorm.DB, *snowflake.OfflineDialector) {
+	t.Helper()
+
+	dialector := snowflake.Offline()
+	dialector.ArrayBindThreshold = threshold
+	db, err := gorm.Open(dialector, &gorm.Config{})
+	require.NoError(t, err)
+	return db, dialector
+}
+
+func TestCreate_BindsArraysPerColumn(t *testing.T) {
+	db, dialector := openArrayBind(t, 2)
+	first := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	second := first.Add(time.Hour)
+	comment := "recalibrated"
+
+	readings := []Reading{
+		{Sensor: "a", Value: 1.5, Count: 3, Valid: true, Raw: []byte{1}, TakenAt: first, Comment: &comment, Revision: 1},
+		{Sensor: "b", Value: 2.5, Count: 4, Raw: []byte{2}, TakenAt: second, Comment: &comment, Revision: 2},
+	}
+	require.NoError(t, db.Create(&readings).Error)
+
+	statements := dialector.Statements()
+	require.Len(t, statements, 1)
+	require.Equal(t, "INSERT INTO READINGS (SENSOR,VALUE,COUNT,VALID,RAW,TAKEN_AT,COMMENT,REVISION) VALUES (?,?,?,?,?,?,?,?);", statements[0].SQL)
+	require.Equal(t, []interface{}{
+		gosnowflake.Array([]string{"a", "b"}),
+		gosnowflake.Array([]float64{1.5, 2.5}),
+		gosnowflake.Array([]int64{3, 4}),
+		gosnowflake.Array([]bool{true, false}),
+		gosnowflake.Array([][]byte{{1}, {2}}),
+		gosnowflake.Array([]time.Time{first, second}, gosnowflake.TimestampNTZType),
+		gosnowflake.Array([]string{comment, comment}),
+		gosnowflake.Array([]int64{1, 2}),
+	}, statements[0].Vars)
+}
+
+func TestCreate_FallsBackToValuesList(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+		readings  []Reading
+	}{
+		{
+			name:      "disabled",
+			threshold: 0,
+			readings:  []Reading{{Sensor: "a"}, {Sensor: "b"}},
+		},
+		{
+			name:      "below threshold",
+			threshold: 3,
+			readings:  []Reading{{Sensor: "a"}, {Sensor: "b"}},
+		},
+		{
+			name:      "null value",
+			threshold: 2,
+			readings:  []Reading{{Sensor: "a", Comment: new(string)}, {Sensor: "b"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, dialector := openArrayBind(t, tt.threshold)
+
+			require.NoError(t, db.Create(&tt.readings).Error)
+
+			statements := dialector.Statements()
+			require.Len(t, statements, 1)
+			want := "INSERT INTO READINGS (SENSOR,VALUE,COUNT,VALID,RAW,TAKEN_AT,COMMENT,REVISION) VALUES (?,?,?,?,?,?,?,?),(?,?,?,?,?,?,?,?);"
+			if statements[0].SQL != want {
+				t.Errorf("got  %s\nwant %s", statements[0].SQL, want)
+			}
+		})
+	}
+}
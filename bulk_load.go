@@ -0,0 +1,371 @@
+package snowflake
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/snowflakedb/gosnowflake"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var ErrBulkLoad = errors.New("bulk load failed")
+
+// LoadOptions configure BulkLoad
+type LoadOptions struct {
+	// RowsPerFile splits the rows into files of at most this many rows, which Snowflake loads in parallel.
+	// Zero stages a single file.
+	RowsPerFile int
+	// Path is the directory on the table stage the files are put in, a new one for every load by default
+	Path string
+	// OnError is the COPY INTO ON_ERROR option, CONTINUE, SKIP_FILE, SKIP_FILE_<n>, SKIP_FILE_<n>% or
+	// ABORT_STATEMENT, the default
+	OnError string
+	// Purge removes the files from the stage once they are loaded
+	Purge bool
+}
+
+// LoadResult is the outcome of one staged file, as reported by COPY INTO
+type LoadResult struct {
+	File       string
+	Status     string
+	RowsParsed int64
+	RowsLoaded int64
+	ErrorsSeen int64
+	FirstError string
+}
+
+var onErrorOption = regexp.MustCompile(`(?i)^(CONTINUE|ABORT_STATEMENT|SKIP_FILE(_\d+%?)?)$`)
+
+// BulkLoad inserts value, a slice of structs, by staging it as gzip compressed CSV files on the table stage and
+// loading them with COPY INTO, which is much faster than Create for large numbers of rows:
+//
+//	results, err := snowflake.BulkLoad(db, &events, snowflake.LoadOptions{RowsPerFile: 100000, Purge: true})
+//
+// The columns are the ones Create would insert. Hooks, associations and the defaults of columns left zero in some
+// rows but not in others are not supported.
+func BulkLoad(db *gorm.DB, value interface{}, opts LoadOptions) ([]LoadResult, error) {
+	load, err := prepareLoad(db, value, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	size := opts.RowsPerFile
+	if size <= 0 {
+		size = len(load.values.Values)
+	}
+	for start, file := 0, 0; start < len(load.values.Values); start, file = start+size, file+1 {
+		var data bytes.Buffer
+		if err := load.encode(&data, load.values.Values[start:min(start+size, len(load.values.Values))]); err != nil {
+			return nil, err
+		}
+
+		name := fmt.Sprintf("data_%d.csv.gz", file)
+		ctx := gosnowflake.WithFileStream(db.Statement.Context, &data)
+		if err := db.Session(&gorm.Session{NewDB: true, Context: ctx}).Exec(load.putSQL(name)).Error; err != nil {
+			return nil, fmt.Errorf("%w: staging %s: %w", ErrBulkLoad, name, err)
+		}
+	}
+
+	rows, err := db.Session(&gorm.Session{NewDB: true}).Raw(load.copySQL()).Rows()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBulkLoad, err)
+	}
+	defer rows.Close()
+	return scanLoadResults(rows)
+}
+
+// EncodeLoadFile writes value, a struct or a slice of structs, to w as BulkLoad stages it
+func EncodeLoadFile(w io.Writer, db *gorm.DB, value interface{}) error {
+	load, err := prepareLoad(db, value, LoadOptions{})
+	if err != nil {
+		return err
+	}
+	return load.encode(w, load.values.Values)
+}
+
+// bulkLoad is a BulkLoad with the rows converted to the columns Create would insert
+type bulkLoad struct {
+	stmt   *gorm.Statement
+	opts   LoadOptions
+	fields []*schema.Field
+	values clause.Values
+}
+
+func prepareLoad(db *gorm.DB, value interface{}, opts LoadOptions) (*bulkLoad, error) {
+	if opts.OnError != "" && !onErrorOption.MatchString(opts.OnError) {
+		return nil, fmt.Errorf("%w: invalid ON_ERROR %q", ErrBulkLoad, opts.OnError)
+	}
+	opts.Path = strings.Trim(opts.Path, "/")
+	if opts.Path == "" {
+		opts.Path = "bulk_load/" + time.Now().UTC().Format("20060102T150405") + "_" + randomSuffix()
+	}
+
+	stmt, values, err := createValues(db, value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBulkLoad, err)
+	}
+
+	load := &bulkLoad{stmt: stmt, opts: opts, values: values}
+	for _, column := range load.values.Columns {
+		load.fields = append(load.fields, stmt.Schema.LookUpField(column.Name))
+	}
+	return load, nil
+}
+
+// createValues converts value, a struct or a slice of structs, to the columns and rows Create would insert
+func createValues(db *gorm.DB, value interface{}) (*gorm.Statement, clause.Values, error) {
+	tx := db.Session(&gorm.Session{}).Model(value)
+	stmt := tx.Statement
+	stmt.Dest = value
+	if err := stmt.Parse(value); err != nil {
+		return nil, clause.Values{}, err
+	}
+	stmt.ReflectValue = reflect.Indirect(reflect.ValueOf(value))
+
+	values := callbacks.ConvertToCreateValues(stmt)
+	return stmt, values, tx.Error
+}
+
+func randomSuffix() string {
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (load *bulkLoad) encode(w io.Writer, rows [][]interface{}) error {
+	zw := gzip.NewWriter(w)
+	var line []byte
+	for _, row := range rows {
+		line = line[:0]
+		for idx, value := range row {
+			if idx > 0 {
+				line = append(line, ',')
+			}
+			v, err := loadValue(load.fields[idx], value)
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrBulkLoad, err)
+			}
+			line = appendCSVField(line, load.fields[idx], v)
+		}
+		line = append(line, '\n')
+		if _, err := zw.Write(line); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// stageLocation is the load's directory on the table stage, e.g. @DB.SCHEMA.%EVENTS/bulk_load/20240501T120000_a1b2c3/
+func (load *bulkLoad) stageLocation() string {
+	parts := splitIdentifier(statementTable(load.stmt))
+	var location strings.Builder
+	location.WriteByte('@')
+	for idx, part := range parts {
+		if idx == len(parts)-1 {
+			location.WriteByte('%')
+		}
+		location.WriteString(load.stmt.Quote(part))
+		if idx < len(parts)-1 {
+			location.WriteByte('.')
+		}
+	}
+	location.WriteString("/" + load.opts.Path + "/")
+	return stringLiteral(location.String())
+}
+
+func (load *bulkLoad) putSQL(name string) string {
+	return "PUT 'file://" + name + "' " + load.stageLocation() + " AUTO_COMPRESS = FALSE SOURCE_COMPRESSION = GZIP OVERWRITE = TRUE"
+}
+
+func (load *bulkLoad) copySQL() string {
+	var sql strings.Builder
+	sql.WriteString("COPY INTO ")
+	sql.WriteString(load.stmt.Quote(statementTable(load.stmt)))
+	sql.WriteString(" (")
+	for idx, column := range load.values.Columns {
+		if idx > 0 {
+			sql.WriteByte(',')
+		}
+		sql.WriteString(load.stmt.Quote(column.Name))
+	}
+	sql.WriteString(") FROM " + load.stageLocation())
+	sql.WriteString(` FILE_FORMAT = (TYPE = CSV COMPRESSION = GZIP FIELD_OPTIONALLY_ENCLOSED_BY = '"')`)
+	if onError := strings.ToUpper(load.opts.OnError); onError != "" {
+		if strings.HasSuffix(onError, "%") {
+			onError = stringLiteral(onError)
+		}
+		sql.WriteString(" ON_ERROR = " + onError)
+	}
+	if load.opts.Purge {
+		sql.WriteString(" PURGE = TRUE")
+	}
+	return sql.String()
+}
+
+func scanLoadResults(rows *sql.Rows) ([]LoadResult, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var results []LoadResult
+	for rows.Next() {
+		var (
+			result                             LoadResult
+			file, status, firstError           sql.NullString
+			rowsParsed, rowsLoaded, errorsSeen sql.NullInt64
+			dest                               = make([]interface{}, len(columns))
+		)
+		for idx, column := range columns {
+			switch strings.ToLower(column) {
+			case "file":
+				dest[idx] = &file
+			case "status":
+				dest[idx] = &status
+			case "rows_parsed":
+				dest[idx] = &rowsParsed
+			case "rows_loaded":
+				dest[idx] = &rowsLoaded
+			case "errors_seen":
+				dest[idx] = &errorsSeen
+			case "first_error":
+				dest[idx] = &firstError
+			default:
+				dest[idx] = new(interface{})
+			}
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		result.File, result.Status, result.FirstError = file.String, status.String, firstError.String
+		result.RowsParsed, result.RowsLoaded, result.ErrorsSeen = rowsParsed.Int64, rowsLoaded.Int64, errorsSeen.Int64
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// loadValue resolves value to nil, bool, int64, uint64, float64, string, []byte or time.Time
+func loadValue(field *schema.Field, value interface{}) (interface{}, error) {
+	if valuer, ok := value.(driver.Valuer); ok {
+		if rv := reflect.ValueOf(valuer); rv.Kind() == reflect.Pointer && rv.IsNil() {
+			return nil, nil
+		}
+		resolved, err := valuer.Value()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field.Name, err)
+		}
+		value = resolved
+	}
+
+	switch value.(type) {
+	case nil:
+		return nil, nil
+	case clause.Expression, gorm.Valuer:
+		return nil, fmt.Errorf("%s is zero in some rows, a staged file cannot fall back to the column default", field.Name)
+	case time.Time:
+		return value, nil
+	}
+
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, nil
+		}
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		return rv.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			if rv.IsNil() {
+				return nil, nil
+			}
+			return rv.Bytes(), nil
+		}
+	case reflect.Struct:
+		if t, ok := rv.Interface().(time.Time); ok {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: cannot stage %T", field.Name, value)
+}
+
+// appendCSVField appends a value normalized by loadValue. NULL is an empty field, strings are always enclosed in
+// quotes so that an empty string stays one.
+func appendCSVField(line []byte, field *schema.Field, value interface{}) []byte {
+	switch v := value.(type) {
+	case nil:
+		return line
+	case []byte:
+		if field.DataType == schema.Bytes {
+			return append(line, strings.ToUpper(hex.EncodeToString(v))...)
+		}
+		return appendCSVString(line, string(v))
+	case string:
+		return appendCSVString(line, v)
+	default:
+		return append(line, loadText(v)...)
+	}
+}
+
+func appendCSVString(line []byte, s string) []byte {
+	line = append(line, '"')
+	line = append(line, strings.ReplaceAll(s, `"`, `""`)...)
+	return append(line, '"')
+}
+
+// loadText is the text Snowflake parses back into value
+func loadText(value interface{}) string {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		switch {
+		case math.IsInf(v, 1):
+			return "inf"
+		case math.IsInf(v, -1):
+			return "-inf"
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case time.Time:
+		return v.UTC().Format("2006-01-02 15:04:05.999999999")
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,109 @@
+package snowflake_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+	snowflake "github.com/vonix/gorm-snowflake"
+	"gorm.io/gorm"
+)
+
+type Shipment struct {
+	ID        uint
+	Carrier   string
+	Weight    float64
+	Fragile   bool
+	Label     []byte
+	ShippedAt time.Time
+	Note      *string
+}
+
+func testShipments() []Shipment {
+	shippedAt := time.Date(2024, 5, 1, 12, 30, 0, 500000700, time.UTC)
+	note := `say "hi"`
+	return []Shipment{
+		{Carrier: "ups", Weight: 1.5, Fragile: true, Label: []byte{0xca, 0xfe}, ShippedAt: shippedAt, Note: &note},
+		{Carrier: "", Weight: 2, ShippedAt: shippedAt},
+	}
+}
+
+func TestEncodeLoadFile_WritesCompressedCSV(t *testing.T) {
+	db, _ := openOffline(t)
+
+	var file bytes.Buffer
+	require.NoError(t, snowflake.EncodeLoadFile(&file, db, testShipments()))
+
+	reader, err := gzip.NewReader(&file)
+	require.NoError(t, err)
+	csv, err := io.ReadAll(reader)
+	require.NoError(t, err)
+
+	want := `"ups",1.5,TRUE,CAFE,2024-05-01 12:30:00.5000007,"say ""hi"""` + "\n" +
+		`"",2,FALSE,,2024-05-01 12:30:00.5000007,` + "\n"
+	require.Equal(t, want, string(csv))
+}
+
+func TestEncodeLoadFile_RejectsPartialDefaults(t *testing.T) {
+	db, _ := openOffline(t)
+
+	shipments := testShipments()
+	shipments[0].ID = 7
+
+	err := snowflake.EncodeLoadFile(io.Discard, db, shipments)
+	require.ErrorIs(t, err, snowflake.ErrBulkLoad)
+}
+
+func TestBulkLoad_PutsFilesAndCopiesThem(t *testing.T) {
+	db, mock := openMock(t, snowflake.Config{}, &gorm.Config{SkipDefaultTransaction: true})
+
+	for _, name := range []string{"data_0.csv.gz", "data_1.csv.gz"} {
+		mock.ExpectExec("PUT 'file://" + name + "' '@%SHIPMENTS/nightly/' AUTO_COMPRESS = FALSE SOURCE_COMPRESSION = GZIP OVERWRITE = TRUE").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	mock.ExpectQuery(`COPY INTO SHIPMENTS (CARRIER,WEIGHT,FRAGILE,LABEL,SHIPPED_AT,NOTE) FROM '@%SHIPMENTS/nightly/' ` +
+		`FILE_FORMAT = (TYPE = CSV COMPRESSION = GZIP FIELD_OPTIONALLY_ENCLOSED_BY = '"') ON_ERROR = 'SKIP_FILE_10%' PURGE = TRUE`).
+		WillReturnRows(sqlmock.NewRows([]string{"file", "status", "rows_parsed", "rows_loaded", "error_limit", "errors_seen", "first_error"}).
+			AddRow("nightly/data_0.csv.gz", "LOADED", 1, 1, 1, 0, nil).
+			AddRow("nightly/data_1.csv.gz", "LOAD_FAILED", 1, 0, 1, 1, "Numeric value 'x' is not recognized"))
+
+	results, err := snowflake.BulkLoad(db, testShipments(), snowflake.LoadOptions{
+		RowsPerFile: 1,
+		Path:        "/nightly/",
+		OnError:     "skip_file_10%",
+		Purge:       true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []snowflake.LoadResult{
+		{File: "nightly/data_0.csv.gz", Status: "LOADED", RowsParsed: 1, RowsLoaded: 1},
+		{File: "nightly/data_1.csv.gz", Status: "LOAD_FAILED", RowsParsed: 1, ErrorsSeen: 1, FirstError: "Numeric value 'x' is not recognized"},
+	}, results)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBulkLoad_QualifiedTable(t *testing.T) {
+	db, mock := openMock(t, snowflake.Config{}, &gorm.Config{SkipDefaultTransaction: true})
+
+	mock.ExpectExec("PUT 'file://data_0.csv.gz' '@ARCHIVE.%SHIPMENTS/nightly/' AUTO_COMPRESS = FALSE SOURCE_COMPRESSION = GZIP OVERWRITE = TRUE").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`COPY INTO ARCHIVE.SHIPMENTS (CARRIER,WEIGHT,FRAGILE,LABEL,SHIPPED_AT,NOTE) FROM '@ARCHIVE.%SHIPMENTS/nightly/' ` +
+		`FILE_FORMAT = (TYPE = CSV COMPRESSION = GZIP FIELD_OPTIONALLY_ENCLOSED_BY = '"')`).
+		WillReturnRows(sqlmock.NewRows([]string{"file", "status", "rows_parsed", "rows_loaded"}).AddRow("nightly/data_0.csv.gz", "LOADED", 2, 2))
+
+	results, err := snowflake.BulkLoad(db.Table("archive.shipments"), testShipments(), snowflake.LoadOptions{Path: "nightly"})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, int64(2), results[0].RowsLoaded)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBulkLoad_RejectsInvalidOnError(t *testing.T) {
+	db, _ := openOffline(t)
+
+	_, err := snowflake.BulkLoad(db, testShipments(), snowflake.LoadOptions{OnError: "CONTINUE; DROP TABLE SHIPMENTS"})
+	require.ErrorIs(t, err, snowflake.ErrBulkLoad)
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/rs/zerolog/log"
 	"gorm.io/gorm"
+	"gorm.io/gorm/migrator"
 )
 
 func (m Migrator) ColumnTypes(value interface{}) ([]gorm.ColumnType, error) {
@@ -13,16 +14,34 @@ func (m Migrator) ColumnTypes(value interface{}) ([]gorm.ColumnType, error) {
 		return m.ColumnTypesFunc(value)
 	}
 
-	cols, err := m.Migrator.ColumnTypes(value)
+	normalized := make([]gorm.ColumnType, 0)
+	err := m.RunWithValue(value, func(stmt *gorm.Statement) (err error) {
+		// gorm's ColumnTypes reads stmt.Table, which lost the schema of a schema.table name
+		rows, err := m.DB.Session(&gorm.Session{}).Table("?", m.CurrentTable(stmt)).Limit(1).Rows()
+		if err != nil {
+			return err
+		}
+
+		defer func() {
+			if closeErr := rows.Close(); err == nil {
+				err = closeErr
+			}
+		}()
+
+		cols, err := rows.ColumnTypes()
+		if err != nil {
+			return err
+		}
+
+		for _, col := range cols {
+			normalized = append(normalized, &normalizedColumnType{c: migrator.ColumnType{SQLColumnType: col}})
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	normalized := make([]gorm.ColumnType, 0, len(cols))
-	for _, col := range cols {
-		normalized = append(normalized, &normalizedColumnType{c: col})
-	}
-
 	return normalized, nil
 }
 
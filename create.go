@@ -1,12 +1,25 @@
 package snowflake
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+
 	"github.com/rs/zerolog/log"
 	"gorm.io/gorm"
 	"gorm.io/gorm/callbacks"
 	"gorm.io/gorm/clause"
 )
 
+const (
+	defaultMaxBindVars      = 16384
+	defaultMaxStatementSize = 1 << 20
+
+	createStatementsKey = "snowflake:create_statements"
+)
+
+var ErrConflictColumnNotInserted = errors.New("ON CONFLICT column is not inserted")
+
 func Create(db *gorm.DB) {
 	if db.Statement.Schema != nil && !db.Statement.Unscoped {
 		for _, c := range db.Statement.Schema.CreateClauses {
@@ -14,157 +27,194 @@ func Create(db *gorm.DB) {
 		}
 	}
 
-	if db.Statement.SQL.String() == "" {
-		var (
-			values                  = callbacks.ConvertToCreateValues(db.Statement)
-			c                       = db.Statement.Clauses["ON CONFLICT"]
-			onConflict, hasConflict = c.Expression.(clause.OnConflict)
-		)
+	if db.Statement.SQL.Len() > 0 {
+		if !db.DryRun && db.Error == nil {
+			db.RowsAffected = 0
+			execCreate(db)
+		}
+		return
+	}
 
-		if hasConflict {
-			if len(db.Statement.Schema.PrimaryFields) > 0 {
-				columnsMap := map[string]bool{}
-				for _, column := range values.Columns {
-					columnsMap[column.Name] = true
-				}
+	var (
+		values                  = callbacks.ConvertToCreateValues(db.Statement)
+		c                       = db.Statement.Clauses["ON CONFLICT"]
+		onConflict, hasConflict = c.Expression.(clause.OnConflict)
+		overwrite               = isOverwrite(db.Statement)
+		statements              = 0
+	)
+
+	if overwrite && hasConflict {
+		_ = db.AddError(ErrOverwriteConflict)
+		return
+	}
+	if overwrite && isBatch(db.Statement) {
+		_ = db.AddError(fmt.Errorf("%w: pass a pointer to the rows", ErrOverwriteInBatches))
+		return
+	}
 
-				for _, field := range db.Statement.Schema.PrimaryFields {
-					if _, ok := columnsMap[field.DBName]; !ok {
-						hasConflict = false
-					}
-				}
-			} else {
-				hasConflict = false
+	if hasConflict {
+		keys := mergeKeys(db.Statement, onConflict)
+		for _, key := range keys {
+			if hasColumn(values.Columns, key.Name) {
+				continue
+			}
+			if !isGeneratedColumn(db.Statement, key.Name) {
+				// the rows could not be matched, a plain INSERT would duplicate them
+				_ = db.AddError(fmt.Errorf("%w: %s", ErrConflictColumnNotInserted, key.Name))
+				return
 			}
+			// a key the database generates, the rows are new
+			hasConflict = false
 		}
+		if len(keys) == 0 {
+			hasConflict = false
+		}
+	}
 
+	render := func(values clause.Values) {
 		if hasConflict {
 			MergeCreate(db, onConflict, values)
-		} else {
-			db.Statement.AddClauseIfNotExists(clause.Insert{})
-			db.Statement.Build("INSERT")
-			db.Statement.WriteByte(' ')
-			db.Statement.AddClause(values)
-
-			if values, ok := db.Statement.Clauses["VALUES"].Expression.(clause.Values); ok {
-				if len(values.Columns) > 0 {
-					db.Statement.WriteByte('(')
-					for idx, column := range values.Columns {
-						if idx > 0 {
-							db.Statement.WriteByte(',')
-						}
-						db.Statement.WriteQuoted(column)
-					}
-					db.Statement.WriteByte(')')
-
-					db.Statement.WriteString(" VALUES ")
-
-					for idx, value := range values.Values {
-						if idx > 0 {
-							db.Statement.WriteByte(',')
-						}
-
-						db.Statement.WriteByte('(')
-						db.Statement.AddVar(db.Statement, value...)
-						db.Statement.WriteByte(')')
-					}
-
-					db.Statement.WriteString(";")
-				} else {
-					log.Warn().Msg("NOT INSERTING, empty columns")
+			return
+		}
+		if overwrite && statements > 0 {
+			appendAfterOverwrite(db.Statement)
+		}
+		buildInsert(db, values)
+	}
+
+	// array binds run like one statement per row, which must not overwrite the rows before
+	if threshold := arrayBindThreshold(db); threshold > 0 && !hasConflict && !overwrite && len(values.Values) >= threshold {
+		if arrayValues, ok := arrayBindValues(db.Statement, values); ok {
+			// one statement binds every row, there is nothing to split
+			values = arrayValues
+		}
+	}
+
+	if db.DryRun || db.Error != nil {
+		render(values)
+		return
+	}
+
+	db.RowsAffected = 0
+	limits := limitsOf(db)
+	if isOverwrite(db.Statement) && splitsOverwrite(db, values, limits, render) {
+		createInTransaction(db, func() { createInChunks(db, values, limits, render, &statements) })
+		// LAST_QUERY_ID counts the COMMIT
+		statements++
+	} else {
+		createInChunks(db, values, limits, render, &statements)
+	}
+	db.InstanceSet(createStatementsKey, statements)
+}
+
+func buildInsert(db *gorm.DB, values clause.Values) {
+	db.Statement.AddClauseIfNotExists(clause.Insert{})
+	db.Statement.Build("INSERT")
+	db.Statement.WriteByte(' ')
+	db.Statement.AddClause(values)
+
+	if values, ok := db.Statement.Clauses["VALUES"].Expression.(clause.Values); ok {
+		if len(values.Columns) > 0 {
+			db.Statement.WriteByte('(')
+			for idx, column := range values.Columns {
+				if idx > 0 {
+					db.Statement.WriteByte(',')
 				}
+				db.Statement.WriteQuoted(column)
 			}
+			db.Statement.WriteByte(')')
+
+			db.Statement.WriteString(" VALUES ")
+
+			for idx, value := range values.Values {
+				if idx > 0 {
+					db.Statement.WriteByte(',')
+				}
+
+				db.Statement.WriteByte('(')
+				db.Statement.AddVar(db.Statement, value...)
+				db.Statement.WriteByte(')')
+			}
+
+			db.Statement.WriteString(";")
+		} else {
+			log.Warn().Msg("NOT INSERTING, empty columns")
 		}
 	}
+}
 
-	if !db.DryRun && db.Error == nil {
-		db.RowsAffected = 0
+// createLimits bound the statements a multi-row Create is split into
+type createLimits struct {
+	bindVars      int
+	statementSize int
+}
 
-		if result, err := db.Statement.ConnPool.ExecContext(db.Statement.Context, db.Statement.SQL.String(), db.Statement.Vars...); err == nil {
-			db.RowsAffected, _ = result.RowsAffected()
-		} else {
-			_ = db.AddError(err)
-		}
-		//UNCOMMENT IN CASE ITS NEEDED TO GET THE RESULTS OF THE INSERT BACK.
-		//REQUIRES change tracking as true on the tables
-		// // do another select on last inserted values to populate default values (e.g. ID)
-		// // this relies on the result of SELECT * FROM CHANGES to align with the order of the VALUES in MERGE statement
-		// if sch := db.Statement.Schema; sch != nil && len(db.Statement.Schema.FieldsWithDefaultDBValue) > 0 {
-		// 	var (
-		// 		fields = make([]*schema.Field, len(sch.FieldsWithDefaultDBValue))
-		// 		values = make([]interface{}, len(sch.FieldsWithDefaultDBValue))
-		// 	)
-
-		// 	db.Statement.SQL.Reset()
-
-		// 	// write select
-		// 	db.Statement.WriteString("SELECT ")
-		// 	// populate fields
-		// 	for idx, field := range sch.FieldsWithDefaultDBValue {
-		// 		if idx > 0 {
-		// 			db.Statement.WriteByte(',')
-		// 		}
-
-		// 		fields[idx] = field
-		// 		db.Statement.WriteQuoted(field.DBName)
-		// 	}
-		// 	db.Statement.WriteString(" FROM ")
-		// 	db.Statement.WriteQuoted(db.Statement.Table)
-		// 	db.Statement.WriteString(" CHANGES(INFORMATION => APPEND_ONLY) BEFORE(statement=>LAST_QUERY_ID());")
-		// 	rows, err := db.Statement.ConnPool.QueryContext(db.Statement.Context, db.Statement.SQL.String(), db.Statement.Vars...)
-		// 	reflectIndex := 0
-		// 	if err == nil {
-		// 		defer rows.Close()
-
-		// 		switch db.Statement.ReflectValue.Kind() {
-		// 		case reflect.Slice, reflect.Array:
-		// 			// the strategy here is to match the returned rows with INSERT only values
-		// 			for rows.Next() {
-		// 			BEGIN:
-		// 				reflectValue := db.Statement.ReflectValue.Index(reflectIndex)
-		// 				if reflect.Indirect(reflectValue).Kind() != reflect.Struct {
-		// 					break
-		// 				}
-
-		// 				for idx, field := range fields {
-		// 					fieldValue := field.ReflectValueOf(db.Statement.Context, reflectValue)
-
-		// 					// skip where default are zeros (non-insert in MERGE)
-		// 					if !fieldValue.IsZero() {
-		// 						reflectIndex++
-
-		// 						if reflectIndex >= db.Statement.ReflectValue.Len() {
-		// 							return
-		// 						}
-
-		// 						goto BEGIN
-		// 					}
-		// 					values[idx] = fieldValue.Addr().Interface()
-		// 				}
-
-		// 				if err := rows.Scan(values...); err != nil {
-		// 					_ = db.AddError(err)
-		// 				}
-		// 			}
-		// 		case reflect.Struct:
-		// 			for idx, field := range fields {
-		// 				values[idx] = field.ReflectValueOf(db.Statement.Context, db.Statement.ReflectValue).Addr().Interface()
-		// 			}
-
-		// 			if rows.Next() {
-		// 				db.AddError(rows.Scan(values...))
-		// 			}
-		// 		}
-		// 	} else {
-		// 		db.AddError(err)
-		// 	}
-		// }
+func limitsOf(db *gorm.DB) createLimits {
+	limits := createLimits{bindVars: defaultMaxBindVars, statementSize: defaultMaxStatementSize}
+	if config := configOf(db); config != nil {
+		if config.MaxBindVars > 0 {
+			limits.bindVars = config.MaxBindVars
+		}
+		if config.MaxStatementSize > 0 {
+			limits.statementSize = config.MaxStatementSize
+		}
+	}
+	return limits
+}
+
+func (limits createLimits) exceededBy(stmt *gorm.Statement) bool {
+	return len(stmt.Vars) > limits.bindVars || stmt.SQL.Len() > limits.statementSize
+}
+
+// createInChunks renders values as one statement and runs it, when the statement is over the limits the rows are
+// split into chunks that fit, run one after another on the statement's ConnPool, inside the transaction if there is one
+func createInChunks(db *gorm.DB, values clause.Values, limits createLimits, render func(clause.Values), statements *int) {
+	resetCreateStatement(db)
+	render(values)
+
+	rows := len(values.Values)
+	if rows > 1 && limits.exceededBy(db.Statement) {
+		// estimate the chunk size from the oversized statement, a chunk that is still too big is split again
+		size := rows
+		if vars := len(db.Statement.Vars); vars > limits.bindVars {
+			size = min(size, rows*limits.bindVars/vars)
+		}
+		if length := db.Statement.SQL.Len(); length > limits.statementSize {
+			size = min(size, rows*limits.statementSize/length)
+		}
+		size = max(1, min(size, rows/2))
+
+		for start := 0; start < rows && db.Error == nil; start += size {
+			chunk := values
+			chunk.Values = values.Values[start:min(start+size, rows)]
+			createInChunks(db, chunk, limits, render, statements)
+		}
+		return
+	}
+
+	*statements++
+	execCreate(db)
+}
+
+func resetCreateStatement(db *gorm.DB) {
+	db.Statement.SQL.Reset()
+	db.Statement.Vars = nil
+	// clause.Values appends to an existing VALUES clause instead of replacing it
+	delete(db.Statement.Clauses, "VALUES")
+}
+
+func execCreate(db *gorm.DB) {
+	if result, err := db.Statement.ConnPool.ExecContext(db.Statement.Context, db.Statement.SQL.String(), db.Statement.Vars...); err == nil {
+		rowsAffected, _ := result.RowsAffected()
+		db.RowsAffected += rowsAffected
+	} else {
+		_ = db.AddError(err)
 	}
 }
 
 func MergeCreate(db *gorm.DB, onConflict clause.OnConflict, values clause.Values) {
 	db.Statement.WriteString("MERGE INTO ")
-	db.Statement.WriteQuoted(db.Statement.Table)
+	db.Statement.WriteQuoted(clause.Table{Name: clause.CurrentTable})
 	db.Statement.WriteString(" USING (VALUES")
 	for idx, value := range values.Values {
 		if idx > 0 {
@@ -176,7 +226,9 @@ func MergeCreate(db *gorm.DB, onConflict clause.OnConflict, values clause.Values
 		db.Statement.WriteByte(')')
 	}
 
-	db.Statement.WriteString(") AS excluded (")
+	db.Statement.WriteString(") AS ")
+	db.Statement.WriteQuoted("excluded")
+	db.Statement.WriteString(" (")
 	for idx, column := range values.Columns {
 		if idx > 0 {
 			db.Statement.WriteByte(',')
@@ -185,18 +237,35 @@ func MergeCreate(db *gorm.DB, onConflict clause.OnConflict, values clause.Values
 	}
 	db.Statement.WriteString(") ON ")
 
+	keys := mergeKeys(db.Statement, onConflict)
 	var where clause.Where
-	for _, field := range db.Statement.Schema.PrimaryFields {
+	for _, key := range keys {
 		where.Exprs = append(where.Exprs, clause.Eq{
-			Column: clause.Column{Table: db.Statement.Table, Name: field.DBName},
-			Value:  clause.Column{Table: "excluded", Name: field.DBName},
+			Column: clause.Column{Table: db.Statement.Table, Name: key.Name},
+			Value:  clause.Column{Table: "excluded", Name: key.Name},
 		})
 	}
 	where.Build(db.Statement)
 
-	if len(onConflict.DoUpdates) > 0 {
-		db.Statement.WriteString(" WHEN MATCHED THEN UPDATE SET ")
-		onConflict.DoUpdates.Build(db.Statement)
+	doUpdates := onConflict.DoUpdates
+	if onConflict.UpdateAll {
+		// gorm expands UpdateAll to every column but the primary key, the MERGE keys are left alone too
+		doUpdates = doUpdates[:0:0]
+		for _, assignment := range onConflict.DoUpdates {
+			if !hasColumn(keys, assignment.Column.Name) {
+				doUpdates = append(doUpdates, assignment)
+			}
+		}
+	}
+
+	if !onConflict.DoNothing && len(doUpdates) > 0 {
+		db.Statement.WriteString(" WHEN MATCHED")
+		if len(onConflict.Where.Exprs) > 0 {
+			db.Statement.WriteString(" AND ")
+			onConflict.Where.Build(db.Statement)
+		}
+		db.Statement.WriteString(" THEN UPDATE SET ")
+		doUpdates.Build(db.Statement)
 	}
 
 	db.Statement.WriteString(" WHEN NOT MATCHED THEN INSERT (")
@@ -223,3 +292,47 @@ func MergeCreate(db *gorm.DB, onConflict clause.OnConflict, values clause.Values
 	db.Statement.WriteString(")")
 	db.Statement.WriteString(";")
 }
+
+// mergeKeys returns the columns rows are matched on, the conflict columns when given, the primary key otherwise
+func mergeKeys(stmt *gorm.Statement, onConflict clause.OnConflict) []clause.Column {
+	if len(onConflict.Columns) > 0 {
+		keys := make([]clause.Column, 0, len(onConflict.Columns))
+		for _, column := range onConflict.Columns {
+			// callers may name the field instead of the column
+			if stmt.Schema != nil {
+				if field := stmt.Schema.LookUpField(column.Name); field != nil {
+					column.Name = field.DBName
+				}
+			}
+			keys = append(keys, column)
+		}
+		return keys
+	}
+
+	if stmt.Schema == nil {
+		return nil
+	}
+	keys := make([]clause.Column, 0, len(stmt.Schema.PrimaryFields))
+	for _, field := range stmt.Schema.PrimaryFields {
+		keys = append(keys, clause.Column{Name: field.DBName})
+	}
+	return keys
+}
+
+// isGeneratedColumn reports whether the database fills column in when it is not inserted, like an identity
+func isGeneratedColumn(stmt *gorm.Statement, column string) bool {
+	if stmt.Schema == nil {
+		return false
+	}
+	field := stmt.Schema.LookUpField(column)
+	return field != nil && (field.AutoIncrement || field.HasDefaultValue)
+}
+
+func hasColumn(columns []clause.Column, name string) bool {
+	for _, column := range columns {
+		if strings.EqualFold(column.Name, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package snowflake_test
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+	snowflake "github.com/vonix/gorm-snowflake"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Listing struct {
+	ID         uint
+	Source     string
+	ExternalID string
+	Title      string
+}
+
+func TestCreate_MergesOnConflictColumns(t *testing.T) {
+	tests := []struct {
+		name       string
+		onConflict clause.OnConflict
+		want       string
+	}{
+		{
+			name:       "update all",
+			onConflict: clause.OnConflict{Columns: []clause.Column{{Name: "source"}, {Name: "ExternalID"}}, UpdateAll: true},
+			want: "MERGE INTO LISTINGS USING (VALUES(?,?,?)) AS EXCLUDED (SOURCE,EXTERNAL_ID,TITLE) " +
+				"ON LISTINGS.SOURCE = EXCLUDED.SOURCE AND LISTINGS.EXTERNAL_ID = EXCLUDED.EXTERNAL_ID " +
+				"WHEN MATCHED THEN UPDATE SET TITLE=EXCLUDED.TITLE " +
+				"WHEN NOT MATCHED THEN INSERT (SOURCE,EXTERNAL_ID,TITLE) VALUES (EXCLUDED.SOURCE,EXCLUDED.EXTERNAL_ID,EXCLUDED.TITLE);",
+		},
+		{
+			name: "guarded update",
+			onConflict: clause.OnConflict{
+				Columns:   []clause.Column{{Name: "SOURCE"}, {Name: "EXTERNAL_ID"}},
+				Where:     clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "LISTINGS.TITLE <> EXCLUDED.TITLE"}}},
+				DoUpdates: clause.AssignmentColumns([]string{"TITLE"}),
+			},
+			want: "MERGE INTO LISTINGS USING (VALUES(?,?,?)) AS EXCLUDED (SOURCE,EXTERNAL_ID,TITLE) " +
+				"ON LISTINGS.SOURCE = EXCLUDED.SOURCE AND LISTINGS.EXTERNAL_ID = EXCLUDED.EXTERNAL_ID " +
+				"WHEN MATCHED AND LISTINGS.TITLE <> EXCLUDED.TITLE THEN UPDATE SET TITLE=EXCLUDED.TITLE " +
+				"WHEN NOT MATCHED THEN INSERT (SOURCE,EXTERNAL_ID,TITLE) VALUES (EXCLUDED.SOURCE,EXCLUDED.EXTERNAL_ID,EXCLUDED.TITLE);",
+		},
+		{
+			name:       "do nothing",
+			onConflict: clause.OnConflict{Columns: []clause.Column{{Name: "SOURCE"}, {Name: "EXTERNAL_ID"}}, DoNothing: true},
+			want: "MERGE INTO LISTINGS USING (VALUES(?,?,?)) AS EXCLUDED (SOURCE,EXTERNAL_ID,TITLE) " +
+				"ON LISTINGS.SOURCE = EXCLUDED.SOURCE AND LISTINGS.EXTERNAL_ID = EXCLUDED.EXTERNAL_ID " +
+				"WHEN NOT MATCHED THEN INSERT (SOURCE,EXTERNAL_ID,TITLE) VALUES (EXCLUDED.SOURCE,EXCLUDED.EXTERNAL_ID,EXCLUDED.TITLE);",
+		},
+		{
+			name:       "key not inserted",
+			onConflict: clause.OnConflict{UpdateAll: true},
+			want:       "INSERT INTO LISTINGS (SOURCE,EXTERNAL_ID,TITLE) VALUES (?,?,?);",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, dialector := openOffline(t)
+
+			listing := Listing{Source: "crm", ExternalID: "42", Title: "a"}
+			require.NoError(t, db.Clauses(tt.onConflict).Create(&listing).Error)
+
+			statements := dialector.Statements()
+			require.Len(t, statements, 1)
+			if statements[0].SQL != tt.want {
+				t.Errorf("got  %s\nwant %s", statements[0].SQL, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreate_RejectsConflictColumnsNotInserted(t *testing.T) {
+	db, dialector := openOffline(t)
+
+	err := db.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "SOURCE"}, {Name: "EXTERNAL_ID"}}, UpdateAll: true}).
+		Omit("ExternalID").Create(&Listing{Source: "crm", ExternalID: "42", Title: "a"}).Error
+	require.ErrorIs(t, err, snowflake.ErrConflictColumnNotInserted)
+	require.Empty(t, dialector.Statements())
+}
+
+func TestCreate_MergesOnPrimaryKeyByDefault(t *testing.T) {
+	db, dialector := openOffline(t)
+
+	require.NoError(t, db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&Listing{ID: 1, Source: "crm", ExternalID: "42", Title: "a"}).Error)
+
+	want := "MERGE INTO LISTINGS USING (VALUES(?,?,?,?)) AS EXCLUDED (SOURCE,EXTERNAL_ID,TITLE,ID) " +
+		"ON LISTINGS.ID = EXCLUDED.ID " +
+		"WHEN MATCHED THEN UPDATE SET SOURCE=EXCLUDED.SOURCE,EXTERNAL_ID=EXCLUDED.EXTERNAL_ID,TITLE=EXCLUDED.TITLE " +
+		"WHEN NOT MATCHED THEN INSERT (SOURCE,EXTERNAL_ID,TITLE,ID) VALUES (EXCLUDED.SOURCE,EXCLUDED.EXTERNAL_ID,EXCLUDED.TITLE,EXCLUDED.ID);"
+	require.Equal(t, want, dialector.Statements()[0].SQL)
+}
+
+func TestCreate_SplitsRowsAtBindLimit(t *testing.T) {
+	db, mock := openMock(t, snowflake.Config{MaxBindVars: 6}, &gorm.Config{})
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO LISTINGS (SOURCE,EXTERNAL_ID,TITLE) VALUES (?,?,?),(?,?,?);").
+		WithArgs("crm", "1", "a", "crm", "2", "b").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("INSERT INTO LISTINGS (SOURCE,EXTERNAL_ID,TITLE) VALUES (?,?,?),(?,?,?);").
+		WithArgs("crm", "3", "c", "crm", "4", "d").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("INSERT INTO LISTINGS (SOURCE,EXTERNAL_ID,TITLE) VALUES (?,?,?);").
+		WithArgs("crm", "5", "e").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	listings := []Listing{
+		{Source: "crm", ExternalID: "1", Title: "a"},
+		{Source: "crm", ExternalID: "2", Title: "b"},
+		{Source: "crm", ExternalID: "3", Title: "c"},
+		{Source: "crm", ExternalID: "4", Title: "d"},
+		{Source: "crm", ExternalID: "5", Title: "e"},
+	}
+	result := db.Create(&listings)
+	require.NoError(t, result.Error)
+	require.Equal(t, int64(5), result.RowsAffected)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreate_SplitsMergeAtStatementSize(t *testing.T) {
+	var statements []string
+	matcher := sqlmock.QueryMatcherFunc(func(_, actual string) error {
+		statements = append(statements, actual)
+		if len(actual) > 400 {
+			return fmt.Errorf("statement of %d bytes", len(actual))
+		}
+		return nil
+	})
+
+	db, mock := openMatchingMock(t, snowflake.Config{MaxStatementSize: 400}, &gorm.Config{SkipDefaultTransaction: true}, matcher)
+
+	listings := make([]Listing, 40)
+	for i := range listings {
+		listings[i] = Listing{Source: "crm", ExternalID: strconv.Itoa(i), Title: "a"}
+		mock.ExpectExec("MERGE").WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	result := db.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "SOURCE"}, {Name: "EXTERNAL_ID"}}, UpdateAll: true}).Create(&listings)
+	require.NoError(t, result.Error)
+
+	require.Greater(t, len(statements), 1)
+	require.Equal(t, int64(len(statements)), result.RowsAffected)
+	rows := 0
+	for _, statement := range statements {
+		require.True(t, strings.HasPrefix(statement, "MERGE INTO LISTINGS USING (VALUES"), statement)
+		rows += strings.Count(statement, "(?,?,?)")
+	}
+	require.Equal(t, len(listings), rows)
+}
@@ -0,0 +1,290 @@
+package snowflake
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/snowflakedb/gosnowflake"
+)
+
+const gosnowflakePkgPath = "github.com/snowflakedb/gosnowflake"
+
+// arrayBindTypes maps the types gosnowflake.Array returns to the literal type of their elements, empty if they need
+// none
+var arrayBindTypes = map[reflect.Type]string{
+	reflect.TypeOf(gosnowflake.Array([]int(nil))):                                     "",
+	reflect.TypeOf(gosnowflake.Array([]int64(nil))):                                   "",
+	reflect.TypeOf(gosnowflake.Array([]float64(nil))):                                 "",
+	reflect.TypeOf(gosnowflake.Array([]bool(nil))):                                    "",
+	reflect.TypeOf(gosnowflake.Array([]string(nil))):                                  "",
+	reflect.TypeOf(gosnowflake.Array([][]byte(nil))):                                  "",
+	reflect.TypeOf(gosnowflake.Array([]time.Time(nil), gosnowflake.TimestampNTZType)): "TIMESTAMP_NTZ",
+	reflect.TypeOf(gosnowflake.Array([]time.Time(nil), gosnowflake.TimestampLTZType)): "TIMESTAMP_LTZ",
+	reflect.TypeOf(gosnowflake.Array([]time.Time(nil), gosnowflake.TimestampTZType)):  "TIMESTAMP_TZ",
+	reflect.TypeOf(gosnowflake.Array([]time.Time(nil), gosnowflake.DateType)):         "DATE",
+	reflect.TypeOf(gosnowflake.Array([]time.Time(nil), gosnowflake.TimeType)):         "TIME",
+}
+
+// Explain inlines vars into sql as Snowflake literals, the result runs as is in a worksheet. Statements with
+// gosnowflake.Array binds run once per array element, they are rendered as one statement per element.
+func (dialector Dialector) Explain(sql string, vars ...interface{}) string {
+	rows := arrayBindRows(vars)
+	if rows < 0 {
+		return explainRow(sql, vars, -1)
+	}
+
+	statements := make([]string, 0, rows)
+	for i := 0; i < rows; i++ {
+		statements = append(statements, strings.TrimSuffix(strings.TrimSpace(explainRow(sql, vars, i)), ";"))
+	}
+	return strings.Join(statements, ";\n")
+}
+
+// explainRow replaces the placeholders outside of literals, identifiers and comments, array binds contribute
+// their element at row
+func explainRow(sql string, vars []interface{}, row int) string {
+	var (
+		out  strings.Builder
+		next int
+	)
+
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == '\'' || c == '"':
+			end := skipQuoted(sql, i, c)
+			out.WriteString(sql[i:end])
+			i = end - 1
+		case c == '$' && strings.HasPrefix(sql[i:], "$$"):
+			end := len(sql)
+			if j := strings.Index(sql[i+2:], "$$"); j >= 0 {
+				end = i + 2 + j + 2
+			}
+			out.WriteString(sql[i:end])
+			i = end - 1
+		case c == '-' && strings.HasPrefix(sql[i:], "--"), c == '/' && strings.HasPrefix(sql[i:], "//"):
+			end := len(sql)
+			if j := strings.IndexByte(sql[i:], '\n'); j >= 0 {
+				end = i + j
+			}
+			out.WriteString(sql[i:end])
+			i = end - 1
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			end := len(sql)
+			if j := strings.Index(sql[i+2:], "*/"); j >= 0 {
+				end = i + 2 + j + 2
+			}
+			out.WriteString(sql[i:end])
+			i = end - 1
+		case c == '?' && next < len(vars):
+			value := vars[next]
+			if elements, ok := arrayBindElements(value); ok {
+				if elements == nil {
+					// an array Explain can't render, left as the placeholder
+					out.WriteByte('?')
+					next++
+					continue
+				}
+				value = nil
+				if row < len(elements) {
+					value = elements[row]
+				}
+			}
+			out.WriteString(sqlLiteral(value))
+			next++
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.String()
+}
+
+// skipQuoted returns the index after the literal or identifier starting at start, quotes are escaped by doubling
+// them and, in string literals, with a backslash
+func skipQuoted(sql string, start int, quote byte) int {
+	for i := start + 1; i < len(sql); i++ {
+		switch sql[i] {
+		case '\\':
+			if quote == '\'' {
+				i++
+			}
+		case quote:
+			if i+1 < len(sql) && sql[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(sql)
+}
+
+// sqlLiteral renders value the way the driver binds it, values without a Snowflake literal as their text
+func sqlLiteral(value interface{}) string {
+	literal, err := inlineLiteral(value)
+	if err != nil {
+		return stringLiteral(fmt.Sprintf("%v", reflect.Indirect(reflect.ValueOf(value))))
+	}
+	return literal
+}
+
+// inlineLiteral renders value the way the driver binds it, it fails for values the driver would reject
+func inlineLiteral(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "NULL", nil
+	case explainedLiteral:
+		return string(v), nil
+	case json.RawMessage:
+		return jsonLiteral(v), nil
+	case time.Time:
+		return timestampLiteral(v.UTC(), "TIMESTAMP_NTZ"), nil
+	case []byte:
+		return binaryLiteral(v), nil
+	case string:
+		return stringLiteral(v), nil
+	case bool:
+		if v {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return "NULL", nil
+	}
+
+	if valuer, ok := value.(driver.Valuer); ok {
+		resolved, err := valuer.Value()
+		if err != nil {
+			return "", err
+		}
+		if isJSONValue(rv) {
+			switch raw := resolved.(type) {
+			case string:
+				return jsonLiteral([]byte(raw)), nil
+			case []byte:
+				return jsonLiteral(raw), nil
+			}
+		}
+		return inlineLiteral(resolved)
+	}
+
+	switch rv.Kind() {
+	case reflect.Pointer:
+		return inlineLiteral(rv.Elem().Interface())
+	case reflect.Bool:
+		return inlineLiteral(rv.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return floatLiteral(rv.Float(), rv.Type().Bits()), nil
+	case reflect.String:
+		return stringLiteral(rv.String()), nil
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return binaryLiteral(rv.Bytes()), nil
+		}
+	}
+	return "", fmt.Errorf("no literal for %T", value)
+}
+
+func stringLiteral(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `''`).Replace(s) + "'"
+}
+
+func binaryLiteral(b []byte) string {
+	return "X'" + strings.ToUpper(hex.EncodeToString(b)) + "'"
+}
+
+func jsonLiteral(b []byte) string {
+	return "PARSE_JSON(" + stringLiteral(string(b)) + ")"
+}
+
+func floatLiteral(f float64, bits int) string {
+	switch {
+	case math.IsNaN(f):
+		return "'NaN'::FLOAT"
+	case math.IsInf(f, 1):
+		return "'inf'::FLOAT"
+	case math.IsInf(f, -1):
+		return "'-inf'::FLOAT"
+	}
+	return strconv.FormatFloat(f, 'g', -1, bits)
+}
+
+func timestampLiteral(t time.Time, typ string) string {
+	switch typ {
+	case "DATE":
+		return "'" + t.Format("2006-01-02") + "'::DATE"
+	case "TIME":
+		return "'" + t.Format("15:04:05.999999999") + "'::TIME"
+	case "TIMESTAMP_TZ", "TIMESTAMP_LTZ":
+		return "'" + t.Format("2006-01-02 15:04:05.999999999 -07:00") + "'::" + typ
+	}
+	return "'" + t.Format("2006-01-02 15:04:05.999999999") + "'::" + typ
+}
+
+// isJSONValue reports whether rv is a JSON document type like datatypes.JSON or datatypes.JSONMap, a byte slice,
+// map or slice that marshals itself
+func isJSONValue(rv reflect.Value) bool {
+	if _, ok := rv.Interface().(json.Marshaler); !ok {
+		return false
+	}
+	if rv.Kind() == reflect.Pointer {
+		rv = rv.Elem()
+	}
+	return rv.Kind() == reflect.Slice || rv.Kind() == reflect.Map
+}
+
+// arrayBindElements returns the elements of a gosnowflake.Array bind, timestamps as the literal the array type binds.
+// ok is false for other values, elements is nil for arrays of a type Explain doesn't know.
+func arrayBindElements(value interface{}) (elements []interface{}, ok bool) {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Slice {
+		return nil, false
+	}
+
+	timeType, known := arrayBindTypes[rv.Type()]
+	if !known {
+		return nil, rv.Elem().Type().PkgPath() == gosnowflakePkgPath
+	}
+
+	slice := rv.Elem()
+	elements = make([]interface{}, slice.Len())
+	for i := range elements {
+		element := slice.Index(i).Interface()
+		if t, ok := element.(time.Time); ok && timeType != "" {
+			if timeType == "TIMESTAMP_NTZ" || timeType == "TIMESTAMP_LTZ" {
+				t = t.UTC()
+			}
+			element = explainedLiteral(timestampLiteral(t, timeType))
+		}
+		elements[i] = element
+	}
+	return elements, true
+}
+
+// arrayBindRows returns the number of statements an execution with array binds amounts to, -1 without array binds
+func arrayBindRows(vars []interface{}) int {
+	rows := -1
+	for _, value := range vars {
+		if elements, ok := arrayBindElements(value); ok && elements != nil && len(elements) > rows {
+			rows = len(elements)
+		}
+	}
+	return rows
+}
+
+// explainedLiteral is a value already rendered as a literal
+type explainedLiteral string
@@ -0,0 +1,91 @@
+package snowflake_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/snowflakedb/gosnowflake"
+	"github.com/stretchr/testify/require"
+	snowflake "github.com/vonix/gorm-snowflake"
+)
+
+// jsonDocument is a JSON column type like datatypes.JSON
+type jsonDocument json.RawMessage
+
+func (j jsonDocument) Value() (driver.Value, error) {
+	return string(j), nil
+}
+
+func (j jsonDocument) MarshalJSON() ([]byte, error) {
+	return j, nil
+}
+
+type status string
+
+func TestExplain_RendersSnowflakeLiterals(t *testing.T) {
+	berlin := time.FixedZone("CEST", 2*60*60)
+	name := "a"
+	var nilName *string
+
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"nil", nil, "NULL"},
+		{"nil pointer", nilName, "NULL"},
+		{"pointer", &name, "'a'"},
+		{"string", "O'Brien", "'O''Brien'"},
+		{"backslash", `C:\temp`, `'C:\\temp'`},
+		{"named string", status("active"), "'active'"},
+		{"bool", true, "TRUE"},
+		{"int", int64(-42), "-42"},
+		{"uint", uint8(7), "7"},
+		{"float", 1.5, "1.5"},
+		{"float32", float32(0.1), "0.1"},
+		{"nan", math.NaN(), "'NaN'::FLOAT"},
+		{"infinity", math.Inf(-1), "'-inf'::FLOAT"},
+		{"time", time.Date(2024, 5, 1, 14, 30, 0, 123000000, berlin), "'2024-05-01 12:30:00.123'::TIMESTAMP_NTZ"},
+		{"bytes", []byte{0x0a, 0xff}, "X'0AFF'"},
+		{"raw json", json.RawMessage(`{"a":"it's"}`), `PARSE_JSON('{"a":"it''s"}')`},
+		{"json valuer", jsonDocument(`[1,2]`), "PARSE_JSON('[1,2]')"},
+		{"null string", sql.NullString{}, "NULL"},
+		{"valid null string", sql.NullString{String: "a", Valid: true}, "'a'"},
+		{"null time", sql.NullTime{Time: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), Valid: true}, "'2024-05-01 00:00:00'::TIMESTAMP_NTZ"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := snowflake.Dialector{}.Explain("SELECT ?", tt.value)
+			if want := "SELECT " + tt.want; got != want {
+				t.Errorf("Explain() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestExplain_SkipsPlaceholdersInLiteralsAndComments(t *testing.T) {
+	sql := `SELECT '?', 'it''s ?', "odd?col", $$ ? $$ /* ? */ FROM T -- ?` + "\nWHERE A = ? AND B = ?"
+
+	got := snowflake.Dialector{}.Explain(sql, 1, "b")
+	require.Equal(t, `SELECT '?', 'it''s ?', "odd?col", $$ ? $$ /* ? */ FROM T -- ?`+"\nWHERE A = 1 AND B = 'b'", got)
+}
+
+func TestExplain_ExpandsArrayBinds(t *testing.T) {
+	ids := gosnowflake.Array([]int{1, 2})
+	names := gosnowflake.Array([]string{"a", "b"})
+	days := gosnowflake.Array([]time.Time{
+		time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC),
+	}, gosnowflake.DateType)
+
+	got := snowflake.Dialector{}.Explain("INSERT INTO T (ID,NAME,DAY,SOURCE) VALUES (?,?,?,?)", ids, names, days, "import")
+
+	want := "INSERT INTO T (ID,NAME,DAY,SOURCE) VALUES (1,'a','2024-05-01'::DATE,'import');\n" +
+		"INSERT INTO T (ID,NAME,DAY,SOURCE) VALUES (2,'b','2024-05-02'::DATE,'import')"
+	require.Equal(t, want, got)
+}
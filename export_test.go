@@ -0,0 +1,11 @@
+package snowflake
+
+import "github.com/snowflakedb/gosnowflake"
+
+// WithDriver replaces the driver used to open physical connections
+func WithDriver(d gosnowflake.InternalSnowflakeDriver) Option {
+	return func(o *options) error {
+		o.driver = d
+		return nil
+	}
+}
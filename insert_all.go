@@ -0,0 +1,354 @@
+package snowflake
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var ErrInvalidMultiTableInsert = errors.New("invalid multi-table insert")
+
+// sourceAlias names the rows of a MultiTableInsert fed by Values
+const sourceAlias = "source"
+
+// MultiTableInsert builds an INSERT ALL or INSERT FIRST statement, which inserts the rows of one source into several
+// tables:
+//
+//	counts, err := snowflake.InsertAll().
+//		Into(&Fact{}, nil).
+//		When("amount > ?", 1000).Into("AUDIT", map[string]string{"ORDER_ID": "ID", "AMOUNT": "AMOUNT"}).
+//		Select(db.Model(&StagedOrder{}).Where("batch = ?", batch)).
+//		Exec(db)
+//
+// The rows inserted are counted per Into, in order.
+type MultiTableInsert struct {
+	first    bool
+	branches []insertBranch
+	source   *gorm.DB
+	rows     interface{}
+}
+
+// insertBranch is an unconditional list of targets, a WHEN condition or the ELSE branch
+type insertBranch struct {
+	when    []interface{}
+	isElse  bool
+	targets []insertTarget
+}
+
+type insertTarget struct {
+	table   interface{}
+	columns map[string]string
+}
+
+// InsertAll inserts each source row into every target whose condition it matches
+func InsertAll() *MultiTableInsert {
+	return &MultiTableInsert{}
+}
+
+// InsertFirst inserts each source row into the targets of the first WHEN condition it matches
+func InsertFirst() *MultiTableInsert {
+	return &MultiTableInsert{first: true}
+}
+
+// When starts a conditional branch, the conditions take the arguments of Where and refer to the source columns.
+// The following Into calls add the branch's targets.
+func (m *MultiTableInsert) When(query interface{}, args ...interface{}) *MultiTableInsert {
+	m.branches = append(m.branches, insertBranch{when: append([]interface{}{query}, args...)})
+	return m
+}
+
+// Else starts the branch for the rows no WHEN condition matched
+func (m *MultiTableInsert) Else() *MultiTableInsert {
+	m.branches = append(m.branches, insertBranch{isElse: true})
+	return m
+}
+
+// Into adds a target, a model or a table name. columns maps its columns, by field or column name, to the source
+// columns or SQL expressions inserted into them. Without columns a model gets the source columns of the same name, a
+// table name the source columns by position.
+func (m *MultiTableInsert) Into(table interface{}, columns map[string]string) *MultiTableInsert {
+	if len(m.branches) == 0 {
+		m.branches = append(m.branches, insertBranch{})
+	}
+	branch := &m.branches[len(m.branches)-1]
+	branch.targets = append(branch.targets, insertTarget{table: table, columns: columns})
+	return m
+}
+
+// Select uses the rows of a query as the source
+func (m *MultiTableInsert) Select(query *gorm.DB) *MultiTableInsert {
+	m.source, m.rows = query, nil
+	return m
+}
+
+// Values uses records, a struct or a slice of structs, as the source. Its columns are the ones Create would insert.
+func (m *MultiTableInsert) Values(records interface{}) *MultiTableInsert {
+	m.source, m.rows = nil, records
+	return m
+}
+
+// Exec runs the statement and returns the number of rows inserted by every Into
+func (m *MultiTableInsert) Exec(db *gorm.DB) ([]int64, error) {
+	stmt, targets, err := m.build(db)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Session(&gorm.Session{NewDB: true}).Raw(stmt.SQL.String(), stmt.Vars...).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make([]int64, targets)
+	if rows.Next() {
+		// one column per Into, "number of rows inserted into <table>"
+		values := make([]sql.NullInt64, targets)
+		dest := make([]interface{}, targets)
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		for i, value := range values {
+			counts[i] = value.Int64
+		}
+	}
+	return counts, rows.Err()
+}
+
+// ToSQL renders the statement with its variables inlined
+func (m *MultiTableInsert) ToSQL(db *gorm.DB) (string, error) {
+	stmt, _, err := m.build(db)
+	if err != nil {
+		return "", err
+	}
+	return db.Dialector.Explain(stmt.SQL.String(), stmt.Vars...), nil
+}
+
+func (m *MultiTableInsert) build(db *gorm.DB) (*gorm.Statement, int, error) {
+	if err := m.validate(); err != nil {
+		return nil, 0, err
+	}
+
+	stmt := &gorm.Statement{DB: db, Context: db.Statement.Context, Clauses: map[string]clause.Clause{}}
+	source, err := m.sourceColumns(db)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if m.first {
+		stmt.WriteString("INSERT FIRST")
+	} else {
+		stmt.WriteString("INSERT ALL")
+	}
+
+	targets := 0
+	for _, branch := range m.branches {
+		switch {
+		case branch.isElse:
+			stmt.WriteString(" ELSE")
+		case branch.when != nil:
+			stmt.WriteString(" WHEN ")
+			clause.Where{Exprs: stmt.BuildCondition(branch.when[0], branch.when[1:]...)}.Build(stmt)
+			stmt.WriteString(" THEN")
+		}
+
+		for _, target := range branch.targets {
+			if err := writeInsertTarget(stmt, target, source); err != nil {
+				return nil, 0, err
+			}
+			targets++
+		}
+	}
+
+	stmt.WriteByte(' ')
+	if err := m.writeSource(stmt); err != nil {
+		return nil, 0, err
+	}
+	return stmt, targets, nil
+}
+
+func (m *MultiTableInsert) validate() error {
+	if m.source == nil && m.rows == nil {
+		return fmt.Errorf("%w: no source, call Select or Values", ErrInvalidMultiTableInsert)
+	}
+	if len(m.branches) == 0 {
+		return fmt.Errorf("%w: no targets, call Into", ErrInvalidMultiTableInsert)
+	}
+
+	conditional := m.branches[0].when != nil
+	for idx, branch := range m.branches {
+		switch {
+		case len(branch.targets) == 0:
+			return fmt.Errorf("%w: WHEN or ELSE without Into", ErrInvalidMultiTableInsert)
+		case branch.isElse && idx != len(m.branches)-1:
+			return fmt.Errorf("%w: ELSE must be the last branch", ErrInvalidMultiTableInsert)
+		case branch.isElse && !conditional:
+			return fmt.Errorf("%w: ELSE needs When conditions before it", ErrInvalidMultiTableInsert)
+		case !branch.isElse && (branch.when != nil) != conditional:
+			return fmt.Errorf("%w: Into without a condition cannot be combined with When", ErrInvalidMultiTableInsert)
+		}
+	}
+	if m.first && !conditional {
+		return fmt.Errorf("%w: INSERT FIRST needs When conditions", ErrInvalidMultiTableInsert)
+	}
+	return nil
+}
+
+// sourceColumns returns the columns of the source rows, nil when a query without a model selects them
+func (m *MultiTableInsert) sourceColumns(db *gorm.DB) ([]string, error) {
+	var columns []string
+	if m.source == nil {
+		_, values, err := createValues(db, m.rows)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidMultiTableInsert, err)
+		}
+		for _, column := range values.Columns {
+			columns = append(columns, column.Name)
+		}
+		return columns, nil
+	}
+
+	query := m.source.Statement
+	if query.Model == nil || len(query.Selects) > 0 || query.Clauses["SELECT"].Expression != nil {
+		return nil, nil
+	}
+	model := &gorm.Statement{DB: db}
+	if err := model.Parse(query.Model); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidMultiTableInsert, err)
+	}
+	return model.Schema.DBNames, nil
+}
+
+func writeInsertTarget(stmt *gorm.Statement, target insertTarget, source []string) error {
+	table := &gorm.Statement{DB: stmt.DB}
+	if name, ok := target.table.(string); ok {
+		table.Table = name
+	} else if err := table.Parse(target.table); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidMultiTableInsert, err)
+	}
+
+	stmt.WriteString(" INTO ")
+	stmt.WriteQuoted(statementTable(table))
+	if len(target.columns) == 0 {
+		if table.Schema == nil || source == nil {
+			return nil
+		}
+		return writeMatchingColumns(stmt, table.Schema, source)
+	}
+
+	columns := make([]string, 0, len(target.columns))
+	for column := range target.columns {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	stmt.WriteString(" (")
+	for idx, column := range columns {
+		if idx > 0 {
+			stmt.WriteByte(',')
+		}
+		name := column
+		// callers may name the field instead of the column
+		if table.Schema != nil {
+			if field := table.Schema.LookUpField(column); field != nil {
+				name = field.DBName
+			}
+		}
+		stmt.WriteQuoted(name)
+	}
+	stmt.WriteString(") VALUES (")
+	for idx, column := range columns {
+		if idx > 0 {
+			stmt.WriteByte(',')
+		}
+		stmt.WriteString(target.columns[column])
+	}
+	stmt.WriteByte(')')
+	return nil
+}
+
+func (m *MultiTableInsert) writeSource(stmt *gorm.Statement) error {
+	if m.source != nil {
+		tx := m.source.Session(&gorm.Session{DryRun: true}).Find(&[]map[string]interface{}{})
+		if tx.Error != nil {
+			return tx.Error
+		}
+		stmt.WriteString(strings.TrimSuffix(strings.TrimSpace(tx.Statement.SQL.String()), ";"))
+		stmt.Vars = append(stmt.Vars, tx.Statement.Vars...)
+		return nil
+	}
+
+	_, values, err := createValues(stmt.DB, m.rows)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidMultiTableInsert, err)
+	}
+
+	stmt.WriteString("SELECT * FROM (VALUES ")
+	for idx, row := range values.Values {
+		if idx > 0 {
+			stmt.WriteByte(',')
+		}
+		for _, value := range row {
+			if _, ok := value.(clause.Expression); ok {
+				return fmt.Errorf("%w: columns with a database default must be set in every record or in none", ErrInvalidMultiTableInsert)
+			}
+		}
+		stmt.WriteByte('(')
+		stmt.AddVar(stmt, row...)
+		stmt.WriteByte(')')
+	}
+	stmt.WriteString(") AS ")
+	stmt.WriteQuoted(sourceAlias)
+	stmt.WriteString(" (")
+	for idx, column := range values.Columns {
+		if idx > 0 {
+			stmt.WriteByte(',')
+		}
+		stmt.WriteQuoted(column.Name)
+	}
+	stmt.WriteByte(')')
+	return nil
+}
+
+// writeMatchingColumns inserts the source columns into the model's columns of the same name, the table may have
+// columns the source doesn't
+func writeMatchingColumns(stmt *gorm.Statement, model *schema.Schema, source []string) error {
+	var columns []string
+	for _, name := range model.DBNames {
+		for _, column := range source {
+			if strings.EqualFold(name, column) {
+				columns = append(columns, column)
+				break
+			}
+		}
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("%w: the source has none of the columns of %s", ErrInvalidMultiTableInsert, model.Table)
+	}
+
+	stmt.WriteString(" (")
+	for idx, column := range columns {
+		if idx > 0 {
+			stmt.WriteByte(',')
+		}
+		stmt.WriteQuoted(column)
+	}
+	stmt.WriteString(") VALUES (")
+	for idx, column := range columns {
+		if idx > 0 {
+			stmt.WriteByte(',')
+		}
+		stmt.WriteQuoted(column)
+	}
+	stmt.WriteByte(')')
+	return nil
+}
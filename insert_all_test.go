@@ -0,0 +1,113 @@
+package snowflake_test
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+	snowflake "github.com/vonix/gorm-snowflake"
+	"gorm.io/gorm"
+)
+
+type ListingAudit struct {
+	ListingID  uint
+	Source     string
+	ExternalID string
+}
+
+func TestInsertAll_RendersTargets(t *testing.T) {
+	tests := []struct {
+		name   string
+		insert *snowflake.MultiTableInsert
+		want   string
+	}{
+		{
+			name: "unconditional",
+			insert: snowflake.InsertAll().
+				Into(&Listing{}, nil).
+				Into(&ListingAudit{}, map[string]string{"ListingID": "ID", "source": "SOURCE"}),
+			want: "INSERT ALL INTO LISTINGS (ID,SOURCE,EXTERNAL_ID,TITLE) VALUES (ID,SOURCE,EXTERNAL_ID,TITLE) " +
+				"INTO LISTING_AUDITS (LISTING_ID,SOURCE) VALUES (ID,SOURCE) " +
+				"SELECT * FROM LISTINGS WHERE source = 'crm'",
+		},
+		{
+			name: "columns of the same name",
+			insert: snowflake.InsertAll().
+				Into(&ListingAudit{}, nil).
+				Into(&SchemaEvent{}, map[string]string{"Kind": "SOURCE"}),
+			want: "INSERT ALL INTO LISTING_AUDITS (SOURCE,EXTERNAL_ID) VALUES (SOURCE,EXTERNAL_ID) " +
+				"INTO RAW.EVENTS (KIND) VALUES (SOURCE) " +
+				"SELECT * FROM LISTINGS WHERE source = 'crm'",
+		},
+		{
+			name: "first",
+			insert: snowflake.InsertFirst().
+				When("title = ?", "").Into("archive.listings", nil).
+				When("source = ?", "crm").Into(&Listing{}, nil).Into(&ListingAudit{}, map[string]string{"LISTING_ID": "ID"}).
+				Else().Into("rejected_listings", nil),
+			want: "INSERT FIRST WHEN title = '' THEN INTO ARCHIVE.LISTINGS " +
+				"WHEN source = 'crm' THEN INTO LISTINGS (ID,SOURCE,EXTERNAL_ID,TITLE) VALUES (ID,SOURCE,EXTERNAL_ID,TITLE) " +
+				"INTO LISTING_AUDITS (LISTING_ID) VALUES (ID) " +
+				"ELSE INTO REJECTED_LISTINGS " +
+				"SELECT * FROM LISTINGS WHERE source = 'crm'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openOffline(t)
+
+			sql, err := tt.insert.Select(db.Model(&Listing{}).Where("source = ?", "crm")).ToSQL(db)
+			require.NoError(t, err)
+			if sql != tt.want {
+				t.Errorf("got  %s\nwant %s", sql, tt.want)
+			}
+		})
+	}
+}
+
+func TestInsertAll_ReportsRowsPerTarget(t *testing.T) {
+	db, mock := openMock(t, snowflake.Config{}, &gorm.Config{SkipDefaultTransaction: true})
+
+	// the table has an ID column the source doesn't
+	want := "INSERT ALL WHEN EXTERNAL_ID <> ? THEN INTO LISTINGS (SOURCE,EXTERNAL_ID,TITLE) VALUES (SOURCE,EXTERNAL_ID,TITLE) " +
+		"INTO LISTING_AUDITS (EXTERNAL_ID,SOURCE) VALUES (EXTERNAL_ID,SOURCE) " +
+		"SELECT * FROM (VALUES (?,?,?),(?,?,?)) AS SOURCE (SOURCE,EXTERNAL_ID,TITLE)"
+	mock.ExpectQuery(want).
+		WithArgs("", "crm", "1", "a", "crm", "", "b").
+		WillReturnRows(sqlmock.NewRows([]string{"number of rows inserted into LISTINGS", "number of rows inserted into LISTING_AUDITS"}).AddRow(1, 1))
+
+	counts, err := snowflake.InsertAll().
+		When("EXTERNAL_ID <> ?", "").
+		Into(&Listing{}, nil).
+		Into(&ListingAudit{}, map[string]string{"ExternalID": "EXTERNAL_ID", "Source": "SOURCE"}).
+		Values([]Listing{{Source: "crm", ExternalID: "1", Title: "a"}, {Source: "crm", Title: "b"}}).
+		Exec(db)
+	require.NoError(t, err)
+	require.Equal(t, []int64{1, 1}, counts)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestInsertAll_RejectsInvalidStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		insert *snowflake.MultiTableInsert
+	}{
+		{name: "no targets", insert: snowflake.InsertAll()},
+		{name: "first without conditions", insert: snowflake.InsertFirst().Into(&Listing{}, nil)},
+		{name: "mixed", insert: snowflake.InsertAll().Into(&Listing{}, nil).When("ID > ?", 1).Into(&ListingAudit{}, nil)},
+		{name: "else first", insert: snowflake.InsertAll().Else().Into(&Listing{}, nil).When("ID > ?", 1).Into(&ListingAudit{}, nil)},
+		{name: "else without when", insert: snowflake.InsertAll().Into(&Listing{}, nil).Else().Into("AUDIT", nil)},
+		{name: "empty branch", insert: snowflake.InsertAll().When("ID > ?", 1).Else().Into(&Listing{}, nil)},
+		{name: "no matching columns", insert: snowflake.InsertAll().Into(&ApiToken{}, nil)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openOffline(t)
+
+			_, err := tt.insert.Select(db.Model(&Listing{})).ToSQL(db)
+			require.ErrorIs(t, err, snowflake.ErrInvalidMultiTableInsert)
+		})
+	}
+}
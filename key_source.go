@@ -0,0 +1,178 @@
+package snowflake
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/snowflakedb/gosnowflake"
+)
+
+var ErrKeySourceFailed = errors.New("failed to resolve private key from key source")
+
+// KeySource supplies the private key for key-pair authentication, it is asked for the key whenever a new
+// physical connection is opened
+type KeySource interface {
+	PrivateKey(ctx context.Context) (*rsa.PrivateKey, error)
+}
+
+// VersionedKeySource is a KeySource that can cheaply report which version of the key it holds. The key is
+// only fetched again when the version changes, so rotating a secret takes effect on the next new connection.
+type VersionedKeySource interface {
+	KeySource
+	KeyVersion(ctx context.Context) (string, error)
+}
+
+// KeySourceFunc adapts a callback to KeySource, it is called for every new connection
+type KeySourceFunc func(ctx context.Context) (*rsa.PrivateKey, error)
+
+func (f KeySourceFunc) PrivateKey(ctx context.Context) (*rsa.PrivateKey, error) {
+	return f(ctx)
+}
+
+// FileKeySource reads a PEM key from path, the file is read again when its size or modification time changes
+func FileKeySource(path, passphrase string) KeySource {
+	return &fileKeySource{path: path, passphrase: passphrase}
+}
+
+type fileKeySource struct {
+	path       string
+	passphrase string
+}
+
+func (s *fileKeySource) KeyVersion(ctx context.Context) (string, error) {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(info.ModTime().UnixNano(), 10) + "-" + strconv.FormatInt(info.Size(), 10), nil
+}
+
+func (s *fileKeySource) PrivateKey(ctx context.Context) (*rsa.PrivateKey, error) {
+	privateKeyPEM, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	return parsePEMPrivateKeyWithPassphrase(string(privateKeyPEM), s.passphrase)
+}
+
+// EnvKeySource reads a PEM key from the environment variable name
+func EnvKeySource(name, passphrase string) KeySource {
+	return &envKeySource{name: name, passphrase: passphrase}
+}
+
+type envKeySource struct {
+	name       string
+	passphrase string
+}
+
+func (s *envKeySource) KeyVersion(ctx context.Context) (string, error) {
+	sum := sha256.Sum256([]byte(os.Getenv(s.name)))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (s *envKeySource) PrivateKey(ctx context.Context) (*rsa.PrivateKey, error) {
+	privateKeyPEM, ok := os.LookupEnv(s.name)
+	if !ok {
+		return nil, fmt.Errorf("%w: environment variable %s is not set", ErrEmptyPrivateKey, s.name)
+	}
+	return parsePEMPrivateKeyWithPassphrase(privateKeyPEM, s.passphrase)
+}
+
+// SecretKeySource resolves a PEM key from a secrets manager. Version should return the secret's version id,
+// Fetch is only called again when it changes. Without Version the secret is fetched once.
+type SecretKeySource struct {
+	Version    func(ctx context.Context) (string, error)
+	Fetch      func(ctx context.Context) (string, error)
+	Passphrase string
+}
+
+func (s SecretKeySource) KeyVersion(ctx context.Context) (string, error) {
+	if s.Version == nil {
+		return "", nil
+	}
+	return s.Version(ctx)
+}
+
+func (s SecretKeySource) PrivateKey(ctx context.Context) (*rsa.PrivateKey, error) {
+	if s.Fetch == nil {
+		return nil, fmt.Errorf("%w: secret key source has no Fetch function", ErrEmptyPrivateKey)
+	}
+
+	privateKeyPEM, err := s.Fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return parsePEMPrivateKeyWithPassphrase(privateKeyPEM, s.Passphrase)
+}
+
+// keyResolver caches the key of a KeySource between connections
+type keyResolver struct {
+	source KeySource
+
+	mu      sync.Mutex
+	key     *rsa.PrivateKey
+	version string
+}
+
+func (r *keyResolver) resolve(ctx context.Context) (*rsa.PrivateKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	versioned, isVersioned := r.source.(VersionedKeySource)
+
+	var version string
+	if isVersioned {
+		v, err := versioned.KeyVersion(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrKeySourceFailed, err)
+		}
+		if r.key != nil && v == r.version {
+			return r.key, nil
+		}
+		version = v
+	}
+
+	key, err := r.source.PrivateKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrKeySourceFailed, err)
+	}
+
+	if err := validatePrivateKey(key); err != nil {
+		return nil, err
+	}
+
+	if isVersioned {
+		r.key, r.version = key, version
+	}
+	return key, nil
+}
+
+// keySourceConnector resolves the private key through a KeySource before opening each physical connection
+type keySourceConnector struct {
+	driver   gosnowflake.InternalSnowflakeDriver
+	config   gosnowflake.Config
+	resolver *keyResolver
+}
+
+func (c *keySourceConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	key, err := c.resolver.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	config := c.config
+	config.PrivateKey = key
+	return gosnowflake.NewConnector(c.driver, config).Connect(ctx)
+}
+
+func (c *keySourceConnector) Driver() driver.Driver {
+	return c.driver
+}
@@ -0,0 +1,179 @@
+package snowflake_test
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"database/sql/driver"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/snowflakedb/gosnowflake"
+	"github.com/stretchr/testify/require"
+	snowflake "github.com/vonix/gorm-snowflake"
+)
+
+// fakeDriver records the config of every connection attempt, connect decides the outcome when set
+type fakeDriver struct {
+	mu      sync.Mutex
+	configs []gosnowflake.Config
+	connect func(config gosnowflake.Config) error
+}
+
+func (d *fakeDriver) Open(dsn string) (driver.Conn, error) {
+	return nil, errors.New("fakeDriver: Open is not supported")
+}
+
+func (d *fakeDriver) OpenWithConfig(ctx context.Context, config gosnowflake.Config) (driver.Conn, error) {
+	d.mu.Lock()
+	d.configs = append(d.configs, config)
+	connect := d.connect
+	d.mu.Unlock()
+
+	if connect != nil {
+		if err := connect(config); err != nil {
+			return nil, err
+		}
+	}
+	return fakeConn{}, nil
+}
+
+func (d *fakeDriver) lastConfig() gosnowflake.Config {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.configs[len(d.configs)-1]
+}
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("fakeConn: not supported")
+}
+func (fakeConn) Close() error              { return nil }
+func (fakeConn) Begin() (driver.Tx, error) { return nil, errors.New("fakeConn: not supported") }
+
+func openWithKeySource(t *testing.T, source snowflake.KeySource, d *fakeDriver) driver.Connector {
+	t.Helper()
+
+	dialector, err := snowflake.OpenWithOptions(
+		snowflake.WithAccount("test-account"),
+		snowflake.WithUser("test-user"),
+		snowflake.WithDatabase("test-database"),
+		snowflake.WithKeySource(source),
+		snowflake.WithDriver(d),
+	)
+	require.NoError(t, err)
+	return dialector.(*snowflake.Dialector).Connector
+}
+
+func parseTestRSAKey(t *testing.T, privateKeyPEM string) *rsa.PrivateKey {
+	t.Helper()
+
+	block, _ := pem.Decode([]byte(privateKeyPEM))
+	require.NotNil(t, block)
+
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	require.NoError(t, err)
+	return key
+}
+
+func TestFileKeySource_ReloadsRotatedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rsa_key.pem")
+	first, second := generateTestRSAKey(t), generateTestRSAKey(t)
+	require.NoError(t, os.WriteFile(path, []byte(first), 0o600))
+
+	d := &fakeDriver{}
+	connector := openWithKeySource(t, snowflake.FileKeySource(path, ""), d)
+
+	_, err := connector.Connect(context.Background())
+	require.NoError(t, err)
+	require.True(t, parseTestRSAKey(t, first).Equal(d.lastConfig().PrivateKey))
+	require.Equal(t, gosnowflake.AuthTypeJwt, d.lastConfig().Authenticator)
+
+	require.NoError(t, os.WriteFile(path, []byte(second), 0o600))
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, later, later))
+
+	_, err = connector.Connect(context.Background())
+	require.NoError(t, err)
+	require.True(t, parseTestRSAKey(t, second).Equal(d.lastConfig().PrivateKey))
+}
+
+func TestEnvKeySource(t *testing.T) {
+	privateKeyPEM := generateTestRSAKey(t)
+	t.Setenv("TEST_SNOWFLAKE_KEY", privateKeyPEM)
+
+	d := &fakeDriver{}
+	connector := openWithKeySource(t, snowflake.EnvKeySource("TEST_SNOWFLAKE_KEY", ""), d)
+
+	_, err := connector.Connect(context.Background())
+	require.NoError(t, err)
+	require.True(t, parseTestRSAKey(t, privateKeyPEM).Equal(d.lastConfig().PrivateKey))
+
+	connector = openWithKeySource(t, snowflake.EnvKeySource("TEST_SNOWFLAKE_KEY_UNSET", ""), d)
+	_, err = connector.Connect(context.Background())
+	require.ErrorIs(t, err, snowflake.ErrKeySourceFailed)
+	require.ErrorIs(t, err, snowflake.ErrEmptyPrivateKey)
+}
+
+func TestSecretKeySource_FetchesOnlyOnNewVersion(t *testing.T) {
+	keys := map[string]string{"v1": generateTestRSAKey(t), "v2": generateTestRSAKey(t)}
+	version, fetches := "v1", 0
+
+	source := snowflake.SecretKeySource{
+		Version: func(ctx context.Context) (string, error) { return version, nil },
+		Fetch: func(ctx context.Context) (string, error) {
+			fetches++
+			return keys[version], nil
+		},
+	}
+
+	d := &fakeDriver{}
+	connector := openWithKeySource(t, source, d)
+
+	for i := 0; i < 3; i++ {
+		_, err := connector.Connect(context.Background())
+		require.NoError(t, err)
+	}
+	require.Equal(t, 1, fetches)
+	require.True(t, parseTestRSAKey(t, keys["v1"]).Equal(d.lastConfig().PrivateKey))
+
+	version = "v2"
+	_, err := connector.Connect(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 2, fetches)
+	require.True(t, parseTestRSAKey(t, keys["v2"]).Equal(d.lastConfig().PrivateKey))
+}
+
+func TestKeySourceFunc_CalledPerConnection(t *testing.T) {
+	key := parseTestRSAKey(t, generateTestRSAKey(t))
+	calls := 0
+
+	d := &fakeDriver{}
+	connector := openWithKeySource(t, snowflake.KeySourceFunc(func(ctx context.Context) (*rsa.PrivateKey, error) {
+		calls++
+		return key, nil
+	}), d)
+
+	for i := 0; i < 2; i++ {
+		_, err := connector.Connect(context.Background())
+		require.NoError(t, err)
+	}
+	require.Equal(t, 2, calls)
+}
+
+func TestKeySourceFunc_Errors(t *testing.T) {
+	d := &fakeDriver{}
+	connector := openWithKeySource(t, snowflake.KeySourceFunc(func(ctx context.Context) (*rsa.PrivateKey, error) {
+		return nil, errors.New("secret manager unavailable")
+	}), d)
+
+	_, err := connector.Connect(context.Background())
+	require.ErrorIs(t, err, snowflake.ErrKeySourceFailed)
+	require.Empty(t, d.configs, "no connection should be attempted without a key")
+}
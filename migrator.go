@@ -15,6 +15,62 @@ func normalizeName(s string) string {
 	return strings.ToUpper(strings.Trim(s, `"`))
 }
 
+// identifierValue returns name as INFORMATION_SCHEMA stores it
+func (m Migrator) identifierValue(name string) string {
+	if dialector, ok := m.Dialector.(Dialector); ok {
+		return dialector.identifierValue(name)
+	}
+	return normalizeName(name)
+}
+
+// tableIdentifier is a possibly qualified table name, each part as INFORMATION_SCHEMA stores it
+type tableIdentifier struct {
+	database string
+	schema   string
+	table    string
+}
+
+// qualifiedTable splits the statement's table into database, schema and table. gorm moves a schema.table name
+// into TableExpr and keeps only the table in stmt.Table, the full name is taken from there when it names the same table.
+func (m Migrator) qualifiedTable(stmt *gorm.Statement) tableIdentifier {
+	name := stmt.Table
+	if expr := stmt.TableExpr; expr != nil && len(expr.Vars) == 0 {
+		parts := splitIdentifier(expr.SQL)
+		if m.identifierValue(parts[len(parts)-1]) == m.identifierValue(stmt.Table) {
+			name = expr.SQL
+		}
+	}
+
+	parts := splitIdentifier(name)
+	table := tableIdentifier{table: m.identifierValue(parts[len(parts)-1])}
+	if len(parts) > 1 {
+		table.schema = m.identifierValue(parts[len(parts)-2])
+	}
+	if len(parts) > 2 {
+		table.database = m.identifierValue(parts[len(parts)-3])
+	}
+	return table
+}
+
+// informationSchema renders the view of the table's database followed by conditions on its schema and name,
+// unqualified tables are looked up in the current database and schema
+func (t tableIdentifier) informationSchema(view string) (string, []interface{}) {
+	sql := "INFORMATION_SCHEMA." + view
+	if t.database != "" {
+		sql = doubleQuote(t.database) + "." + sql
+	}
+
+	var vars []interface{}
+	if t.schema != "" {
+		sql += " WHERE table_schema = ?"
+		vars = append(vars, t.schema)
+	} else {
+		sql += " WHERE table_schema = CURRENT_SCHEMA()"
+	}
+
+	return sql + " AND table_name = ?", append(vars, t.table)
+}
+
 type Migrator struct {
 	migrator.Migrator
 
@@ -166,10 +222,8 @@ func (m Migrator) HasTable(value interface{}) bool {
 
 	var count int64
 	m.RunWithValue(value, func(stmt *gorm.Statement) error {
-		return m.DB.Raw(
-			"SELECT count(*) FROM INFORMATION_SCHEMA.TABLES WHERE table_name = ?",
-			strings.ToUpper(stmt.Table),
-		).Row().Scan(&count)
+		from, vars := m.qualifiedTable(stmt).informationSchema("TABLES")
+		return m.DB.Raw("SELECT count(*) FROM "+from, vars...).Row().Scan(&count)
 	})
 
 	return count > 0
@@ -225,9 +279,10 @@ func (m Migrator) HasColumn(value interface{}, field string) bool {
 			name = field.DBName
 		}
 
+		from, vars := m.qualifiedTable(stmt).informationSchema("COLUMNS")
 		return m.DB.Raw(
-			"SELECT count(*) FROM INFORMATION_SCHEMA.columns WHERE table_name = ? AND column_name = ?",
-			normalizeName(stmt.Table), normalizeName(name),
+			"SELECT count(*) FROM "+from+" AND column_name = ?",
+			append(vars, m.identifierValue(name))...,
 		).Row().Scan(&count)
 	})
 
@@ -320,7 +375,7 @@ func (m Migrator) AlterColumn(value interface{}, field string) error {
 
 			return m.DB.Exec(
 				"ALTER TABLE ? ALTER COLUMN ? ?",
-				clause.Table{Name: stmt.Table}, clause.Column{Name: field.DBName}, fileType,
+				m.CurrentTable(stmt), clause.Column{Name: field.DBName}, fileType,
 			).Error
 		}
 		return fmt.Errorf("failed to look up field with name: %s", field)
@@ -361,9 +416,10 @@ func (m Migrator) DropIndex(value interface{}, name string) error {
 func (m Migrator) HasConstraint(value interface{}, name string) bool {
 	var count int64
 	m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		from, vars := m.qualifiedTable(stmt).informationSchema("TABLE_CONSTRAINTS")
 		return m.DB.Raw(
-			`SELECT count(*) FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS WHERE CONSTRAINT_NAME = ?  AND TABLE_NAME = ?`,
-			strings.ToUpper(name), strings.ToUpper(stmt.Table),
+			"SELECT count(*) FROM "+from+" AND constraint_name = ?",
+			append(vars, m.identifierValue(name))...,
 		).Row().Scan(&count)
 	})
 	return count > 0
@@ -424,14 +480,8 @@ func (m Migrator) FullDataTypeOf(field *schema.Field) (expr clause.Expr) {
 		expr.SQL += " UNIQUE"
 	}
 
-	if field.HasDefaultValue && (field.DefaultValueInterface != nil || field.DefaultValue != "") {
-		if field.DefaultValueInterface != nil {
-			defaultStmt := &gorm.Statement{Vars: []interface{}{field.DefaultValueInterface}}
-			m.Dialector.BindVarTo(defaultStmt, defaultStmt, field.DefaultValueInterface)
-			expr.SQL += " DEFAULT " + m.Dialector.Explain(defaultStmt.SQL.String(), field.DefaultValueInterface)
-		} else if field.DefaultValue != "(-)" {
-			expr.SQL += " DEFAULT " + field.DefaultValue
-		}
+	if field.HasDefaultValue && field.DefaultValue != "" && field.DefaultValue != "(-)" {
+		expr.SQL += " DEFAULT " + defaultValueSQL(field.DefaultValue, m.DataTypeOf(field))
 	}
 
 	return
@@ -1,6 +1,8 @@
 package snowflake_test
 
 import (
+	"database/sql/driver"
+	"strings"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
@@ -108,10 +110,172 @@ func TestHasColumn_GeneratesCorrectSQL(t *testing.T) {
 	db, err := gorm.Open(dialector, &gorm.Config{})
 	require.NoError(t, err)
 
-	mock.ExpectQuery(`SELECT count\(\*\) FROM INFORMATION_SCHEMA.columns WHERE table_name = \? AND column_name = \?`).
+	mock.ExpectQuery(`SELECT count\(\*\) FROM INFORMATION_SCHEMA.COLUMNS WHERE table_schema = CURRENT_SCHEMA\(\) AND table_name = \? AND column_name = \?`).
 		WithArgs("USERS", "NAME").
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
 
 	has := db.Migrator().HasColumn(&User{}, "Name")
 	require.True(t, has)
 }
+
+type OrderItem struct {
+	ID       int64
+	Quantity int
+}
+
+func (OrderItem) TableName() string {
+	return "OrderItems"
+}
+
+func TestHasTable_UsesStoredIdentifier(t *testing.T) {
+	tests := []struct {
+		name          string
+		caseSensitive bool
+		want          string
+	}{
+		{"uppercase mode", false, "ORDERITEMS"},
+		{"case-sensitive mode", true, "OrderItems"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := openMock(t, snowflake.Config{CaseSensitiveIdentifiers: tt.caseSensitive}, &gorm.Config{})
+
+			mock.ExpectQuery("SELECT count(*) FROM INFORMATION_SCHEMA.TABLES WHERE table_schema = CURRENT_SCHEMA() AND table_name = ?").
+				WithArgs(tt.want).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+			require.True(t, db.Migrator().HasTable(&OrderItem{}))
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+type QualifiedEvent struct {
+	ID   int64
+	Kind string
+}
+
+func (QualifiedEvent) TableName() string {
+	return "analytics.raw.events"
+}
+
+type SchemaEvent struct {
+	ID   int64
+	Kind string
+}
+
+func (SchemaEvent) TableName() string {
+	return "raw.events"
+}
+
+func TestIntrospection_ScopedToQualifiedTable(t *testing.T) {
+	tests := []struct {
+		name  string
+		run   func(m gorm.Migrator) bool
+		query string
+		args  []driver.Value
+	}{
+		{
+			name:  "has table in database and schema",
+			run:   func(m gorm.Migrator) bool { return m.HasTable(&QualifiedEvent{}) },
+			query: `SELECT count(*) FROM "ANALYTICS".INFORMATION_SCHEMA.TABLES WHERE table_schema = ? AND table_name = ?`,
+			args:  []driver.Value{"RAW", "EVENTS"},
+		},
+		{
+			name:  "has table in schema",
+			run:   func(m gorm.Migrator) bool { return m.HasTable(&SchemaEvent{}) },
+			query: `SELECT count(*) FROM INFORMATION_SCHEMA.TABLES WHERE table_schema = ? AND table_name = ?`,
+			args:  []driver.Value{"RAW", "EVENTS"},
+		},
+		{
+			name:  "has column",
+			run:   func(m gorm.Migrator) bool { return m.HasColumn(&QualifiedEvent{}, "Kind") },
+			query: `SELECT count(*) FROM "ANALYTICS".INFORMATION_SCHEMA.COLUMNS WHERE table_schema = ? AND table_name = ? AND column_name = ?`,
+			args:  []driver.Value{"RAW", "EVENTS", "KIND"},
+		},
+		{
+			name:  "has constraint",
+			run:   func(m gorm.Migrator) bool { return m.HasConstraint(&SchemaEvent{}, "pk_events") },
+			query: `SELECT count(*) FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS WHERE table_schema = ? AND table_name = ? AND constraint_name = ?`,
+			args:  []driver.Value{"RAW", "EVENTS", "PK_EVENTS"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := openMock(t, snowflake.Config{}, &gorm.Config{})
+
+			mock.ExpectQuery(tt.query).WithArgs(tt.args...).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+			require.True(t, tt.run(db.Migrator()))
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestQualifiedTable_RendersEachPartQuoted(t *testing.T) {
+	dialector := snowflake.Offline()
+	db, err := gorm.Open(dialector, &gorm.Config{})
+	require.NoError(t, err)
+
+	require.NoError(t, db.AutoMigrate(&QualifiedEvent{}))
+
+	var events []SchemaEvent
+	require.NoError(t, db.Find(&events).Error)
+	require.NoError(t, db.Table(`analytics."RawData".events`).Where("id = ?", 1).Delete(&QualifiedEvent{}).Error)
+
+	statements := dialector.Statements()
+	require.Len(t, statements, 3)
+	require.True(t, strings.HasPrefix(statements[0].SQL, "CREATE TABLE IF NOT EXISTS ANALYTICS.RAW.EVENTS ("), statements[0].SQL)
+	require.Equal(t, "SELECT * FROM RAW.EVENTS", statements[1].SQL)
+	require.Equal(t, `DELETE FROM ANALYTICS."RawData".EVENTS WHERE id = ?`, statements[2].SQL)
+}
+
+type Account struct {
+	ID       string `gorm:"primaryKey;default:uuid_string()"`
+	Name     string `gorm:"default:it's new"`
+	Settings string `gorm:"type:VARIANT;default:{}"`
+	OpenedOn string `gorm:"type:DATE;default:current_date"`
+}
+
+func TestAutoMigrate_RendersColumnDefaults(t *testing.T) {
+	dialector := snowflake.Offline()
+	db, err := gorm.Open(dialector, &gorm.Config{})
+	require.NoError(t, err)
+
+	require.NoError(t, db.AutoMigrate(&Account{}))
+
+	sql := dialector.SQL()
+	for _, want := range []string{
+		"ID VARCHAR(256) DEFAULT UUID_STRING()",
+		"NAME VARCHAR DEFAULT 'it''s new'",
+		"SETTINGS VARIANT DEFAULT PARSE_JSON('{}')",
+		"OPENED_ON DATE DEFAULT CURRENT_DATE",
+	} {
+		require.Contains(t, sql, want)
+	}
+}
+
+func TestAutoMigrate_ExistingQualifiedTable(t *testing.T) {
+	db, mock := openMock(t, snowflake.Config{}, &gorm.Config{})
+
+	mock.ExpectQuery("SELECT count(*) FROM INFORMATION_SCHEMA.TABLES WHERE table_schema = ? AND table_name = ?").
+		WithArgs("RAW", "EVENTS").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("SELECT * FROM RAW.EVENTS LIMIT 1").
+		WillReturnRows(mock.NewRowsWithColumnDefinition(mock.NewColumn("ID").OfType("NUMBER", int64(0))))
+	mock.ExpectExec("ALTER TABLE RAW.EVENTS ADD KIND VARCHAR").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.NoError(t, db.AutoMigrate(&SchemaEvent{}))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAlterColumn_QualifiedTable(t *testing.T) {
+	db, mock := openMock(t, snowflake.Config{}, &gorm.Config{})
+
+	mock.ExpectExec("ALTER TABLE RAW.EVENTS ALTER COLUMN KIND VARCHAR").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.NoError(t, db.Migrator().AlterColumn(&SchemaEvent{}, "Kind"))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,204 @@
+package snowflake
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// OfflineStatement is a statement rendered by an OfflineDialector, SQL still contains the bind variables
+type OfflineStatement struct {
+	SQL  string
+	Vars []interface{}
+}
+
+// OfflineDialector renders SQL without a Snowflake connection, e.g. to produce reviewable DDL in a build pipeline:
+//
+//	dialector := snowflake.Offline()
+//	db, _ := gorm.Open(dialector, &gorm.Config{})
+//	db.AutoMigrate(&User{})
+//	fmt.Print(dialector.SQL())
+//
+// Every statement runs as if DryRun were on and is collected instead. Row, Rows and Scan are answered with an empty
+// result, that is what the migrator uses to inspect the schema, so AutoMigrate renders the full CREATE TABLE
+// statements. Those reads are not collected.
+type OfflineDialector struct {
+	Dialector
+
+	mu         sync.Mutex
+	statements []OfflineStatement
+}
+
+// Offline creates an OfflineDialector, its ConnPool never dials
+func Offline() *OfflineDialector {
+	return &OfflineDialector{
+		Dialector: Dialector{Config: &Config{DriverName: SnowflakeDriverName}},
+	}
+}
+
+func (d *OfflineDialector) Initialize(db *gorm.DB) error {
+	d.Conn = sql.OpenDB(offlineConnector{})
+	if err := d.Dialector.Initialize(db); err != nil {
+		return err
+	}
+	db.DryRun = true
+
+	callback := db.Callback()
+	registrations := []error{
+		callback.Create().After("*").Register("snowflake:offline_record", d.record),
+		callback.Query().After("*").Register("snowflake:offline_record", d.record),
+		callback.Update().After("*").Register("snowflake:offline_record", d.record),
+		callback.Delete().After("*").Register("snowflake:offline_record", d.record),
+		callback.Raw().After("*").Register("snowflake:offline_record", d.record),
+		callback.Row().After("gorm:row").Register("snowflake:offline_row", offlineRow),
+	}
+
+	for _, err := range registrations {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Statements returns the statements collected so far
+func (d *OfflineDialector) Statements() []OfflineStatement {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]OfflineStatement(nil), d.statements...)
+}
+
+// SQL returns the collected statements with their variables inlined, one statement per line
+func (d *OfflineDialector) SQL() string {
+	var sql strings.Builder
+	for _, stmt := range d.Statements() {
+		sql.WriteString(strings.TrimSuffix(d.Explain(stmt.SQL, stmt.Vars...), ";"))
+		sql.WriteString(";\n")
+	}
+	return sql.String()
+}
+
+// Reset forgets the collected statements
+func (d *OfflineDialector) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.statements = nil
+}
+
+func (d *OfflineDialector) record(db *gorm.DB) {
+	if db.Error != nil || db.Statement.SQL.Len() == 0 {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.statements = append(d.statements, OfflineStatement{
+		SQL:  db.Statement.SQL.String(),
+		Vars: append([]interface{}(nil), db.Statement.Vars...),
+	})
+}
+
+// offlineRow runs the read gorm skipped for DryRun against the offline pool, callers get empty rows instead of nil
+func offlineRow(db *gorm.DB) {
+	if db.Error != nil || !db.DryRun {
+		return
+	}
+
+	if isRows, ok := db.Get("rows"); ok && isRows.(bool) {
+		db.Statement.Settings.Delete("rows")
+		db.Statement.Dest, db.Error = db.Statement.ConnPool.QueryContext(db.Statement.Context, db.Statement.SQL.String(), db.Statement.Vars...)
+	} else {
+		db.Statement.Dest = db.Statement.ConnPool.QueryRowContext(db.Statement.Context, db.Statement.SQL.String(), db.Statement.Vars...)
+	}
+	db.RowsAffected = -1
+}
+
+// offlineConnector hands out connections that answer every statement without a server
+type offlineConnector struct{}
+
+func (offlineConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return offlineConn{}, nil
+}
+
+func (offlineConnector) Driver() driver.Driver {
+	return offlineDriver{}
+}
+
+type offlineDriver struct{}
+
+func (offlineDriver) Open(name string) (driver.Conn, error) {
+	return offlineConn{}, nil
+}
+
+type offlineConn struct{}
+
+func (offlineConn) Prepare(query string) (driver.Stmt, error) {
+	return offlineStmt{}, nil
+}
+
+func (offlineConn) Close() error {
+	return nil
+}
+
+func (offlineConn) Begin() (driver.Tx, error) {
+	return offlineTx{}, nil
+}
+
+func (offlineConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(0), nil
+}
+
+func (offlineConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return offlineRows{}, nil
+}
+
+func (offlineConn) CheckNamedValue(*driver.NamedValue) error {
+	return nil
+}
+
+type offlineStmt struct{}
+
+func (offlineStmt) Close() error {
+	return nil
+}
+
+func (offlineStmt) NumInput() int {
+	return -1
+}
+
+func (offlineStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(0), nil
+}
+
+func (offlineStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return offlineRows{}, nil
+}
+
+type offlineTx struct{}
+
+func (offlineTx) Commit() error {
+	return nil
+}
+
+func (offlineTx) Rollback() error {
+	return nil
+}
+
+type offlineRows struct{}
+
+func (offlineRows) Columns() []string {
+	return nil
+}
+
+func (offlineRows) Close() error {
+	return nil
+}
+
+func (offlineRows) Next(dest []driver.Value) error {
+	return io.EOF
+}
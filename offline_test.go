@@ -0,0 +1,71 @@
+package snowflake_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	snowflake "github.com/vonix/gorm-snowflake"
+	"gorm.io/gorm"
+)
+
+func openOffline(t *testing.T) (*gorm.DB, *snowflake.OfflineDialector) {
+	t.Helper()
+
+	dialector := snowflake.Offline()
+	db, err := gorm.Open(dialector, &gorm.Config{})
+	require.NoError(t, err)
+	return db, dialector
+}
+
+func TestOffline_AutoMigrateRendersCreateTable(t *testing.T) {
+	db, dialector := openOffline(t)
+
+	require.NoError(t, db.AutoMigrate(&User{}))
+
+	statements := dialector.Statements()
+	require.Len(t, statements, 1)
+	require.True(t, strings.HasPrefix(statements[0].SQL, "CREATE TABLE IF NOT EXISTS USERS ("), statements[0].SQL)
+}
+
+func TestOffline_CollectsStatementsInOrder(t *testing.T) {
+	db, dialector := openOffline(t)
+
+	require.NoError(t, db.Create(&User{ID: 1, Name: "O'Brien"}).Error)
+	require.NoError(t, db.Model(&User{}).Where("id = ?", 1).Update("name", "a").Error)
+
+	var users []User
+	require.NoError(t, db.Where("name = ?", "a").Find(&users).Error)
+	require.Empty(t, users)
+
+	require.NoError(t, db.Delete(&User{}, 1).Error)
+	require.NoError(t, db.Exec("TRUNCATE TABLE USERS").Error)
+
+	want := []string{
+		"INSERT INTO USERS (NAME,ID) VALUES ('O''Brien',1);",
+		"UPDATE USERS SET NAME='a' WHERE id = 1;",
+		"SELECT * FROM USERS WHERE name = 'a';",
+		"DELETE FROM USERS WHERE USERS.ID = 1;",
+		"TRUNCATE TABLE USERS;",
+	}
+	require.Equal(t, strings.Join(want, "\n")+"\n", dialector.SQL())
+
+	dialector.Reset()
+	require.Empty(t, dialector.Statements())
+}
+
+func TestOffline_AnswersReadsWithEmptyResults(t *testing.T) {
+	db, dialector := openOffline(t)
+
+	var count int64
+	require.NoError(t, db.Raw("SELECT COUNT(*) FROM USERS").Scan(&count).Error)
+	require.Zero(t, count)
+
+	rows, err := db.Raw("SELECT * FROM USERS").Rows()
+	require.NoError(t, err)
+	require.False(t, rows.Next())
+	require.NoError(t, rows.Close())
+
+	require.False(t, db.Migrator().HasTable(&User{}))
+	require.Empty(t, dialector.Statements())
+}
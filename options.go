@@ -0,0 +1,417 @@
+package snowflake
+
+import (
+	"crypto/rsa"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/snowflakedb/gosnowflake"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidOption             = errors.New("invalid option")
+	ErrMissingCredentials        = errors.New("missing credentials: an authentication option is required")
+	ErrConflictingAuthentication = errors.New("conflicting authentication: only one authentication option can be set")
+)
+
+// OCSPMode controls how certificate revocation is checked when connecting
+type OCSPMode int
+
+const (
+	// OCSPFailOpen allows the connection when the OCSP responder is unreachable, the driver default
+	OCSPFailOpen OCSPMode = iota
+	// OCSPFailClosed refuses the connection unless revocation status can be confirmed
+	OCSPFailClosed
+	// OCSPDisabled skips OCSP checks entirely
+	OCSPDisabled
+)
+
+type authMethod int
+
+const (
+	authNone authMethod = iota
+	authPassword
+	authKeyPair
+	authKeySource
+	authOAuth
+	authPAT
+)
+
+type options struct {
+	config gosnowflake.Config
+
+	auth          authMethod
+	authCount     int
+	privateKeyPEM string
+	passphrase    string
+	keySource     KeySource
+	secondaryPEM  string
+	secondaryPass string
+	secondaryKey  *rsa.PrivateKey
+	tokenProvider TokenProvider
+	sessionParams map[string]string
+	retry         *RetryPolicy
+
+	// set by the tests, see export_test.go
+	driver gosnowflake.InternalSnowflakeDriver
+}
+
+// Option configures a connection built by OpenWithOptions
+type Option func(*options) error
+
+// OpenWithOptions builds a dialector from functional options, for example
+//
+//	snowflake.OpenWithOptions(
+//		snowflake.WithAccount("myorg-myaccount"),
+//		snowflake.WithUser("LOADER"),
+//		snowflake.WithPrivateKey(pemString),
+//		snowflake.WithDatabase("ANALYTICS"),
+//		snowflake.WithLoginTimeout(30*time.Second),
+//	)
+//
+// Account, user and database are always required, as is exactly one authentication option.
+func OpenWithOptions(opts ...Option) (gorm.Dialector, error) {
+	o := &options{}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+
+	config, err := o.build()
+	if err != nil {
+		return nil, err
+	}
+
+	connector, err := o.connector(*config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Dialector{
+		Config: &Config{
+			DriverName:    SnowflakeDriverName,
+			Connector:     connector,
+			SessionParams: o.sessionParams,
+			Retry:         o.retry,
+		},
+	}, nil
+}
+
+func (o *options) connector(config gosnowflake.Config) (driver.Connector, error) {
+	var sfDriver gosnowflake.InternalSnowflakeDriver = gosnowflake.SnowflakeDriver{}
+	if o.driver != nil {
+		sfDriver = o.driver
+	}
+
+	if o.keySource != nil {
+		return &keySourceConnector{
+			driver:   sfDriver,
+			config:   config,
+			resolver: &keyResolver{source: o.keySource},
+		}, nil
+	}
+
+	if o.tokenProvider != nil {
+		return &tokenConnector{
+			driver:   sfDriver,
+			config:   config,
+			provider: o.tokenProvider,
+		}, nil
+	}
+
+	if o.secondaryKey != nil {
+		return newRotatingConnector(sfDriver, config, config.PrivateKey, o.secondaryKey)
+	}
+
+	return gosnowflake.NewConnector(sfDriver, config), nil
+}
+
+func (o *options) build() (*gosnowflake.Config, error) {
+	if err := validateRequired(o.config.Account, "account", ErrInvalidAccount); err != nil {
+		return nil, err
+	}
+
+	if err := validateRequired(o.config.User, "user", ErrInvalidUser); err != nil {
+		return nil, err
+	}
+
+	if err := validateRequired(o.config.Database, "database", ErrInvalidDatabase); err != nil {
+		return nil, err
+	}
+
+	if o.authCount > 1 {
+		return nil, ErrConflictingAuthentication
+	}
+
+	if o.secondaryPEM != "" && o.auth != authKeyPair {
+		return nil, fmt.Errorf("%w: a secondary private key requires WithPrivateKey or WithEncryptedPrivateKey", ErrInvalidOption)
+	}
+
+	config := o.config
+	switch o.auth {
+	case authPassword:
+		if err := validateRequired(config.Password, "password", ErrMissingCredentials); err != nil {
+			return nil, err
+		}
+		config.Authenticator = gosnowflake.AuthTypeSnowflake
+	case authKeyPair:
+		if err := validateRequired(o.privateKeyPEM, "privateKeyPEM", ErrEmptyPrivateKey); err != nil {
+			return nil, err
+		}
+
+		privateKey, err := parsePEMPrivateKeyWithPassphrase(o.privateKeyPEM, o.passphrase)
+		if err != nil {
+			return nil, err
+		}
+		config.Authenticator = gosnowflake.AuthTypeJwt
+		config.PrivateKey = privateKey
+
+		if o.secondaryPEM != "" {
+			secondaryKey, err := parsePEMPrivateKeyWithPassphrase(o.secondaryPEM, o.secondaryPass)
+			if err != nil {
+				return nil, err
+			}
+			o.secondaryKey = secondaryKey
+		}
+	case authKeySource:
+		if o.keySource == nil {
+			return nil, fmt.Errorf("%w: key source cannot be nil", ErrEmptyPrivateKey)
+		}
+		config.Authenticator = gosnowflake.AuthTypeJwt
+	case authOAuth, authPAT:
+		if o.tokenProvider == nil {
+			return nil, ErrMissingTokenProvider
+		}
+		config.Authenticator = gosnowflake.AuthTypeOAuth
+		if o.auth == authPAT {
+			config.Authenticator = gosnowflake.AuthTypePat
+		}
+	default:
+		return nil, ErrMissingCredentials
+	}
+
+	return &config, nil
+}
+
+func (o *options) setAuth(method authMethod) {
+	o.auth = method
+	o.authCount++
+}
+
+func (o *options) setParam(name, value string) {
+	if o.config.Params == nil {
+		o.config.Params = map[string]*string{}
+	}
+	o.config.Params[name] = &value
+}
+
+func WithAccount(account string) Option {
+	return func(o *options) error {
+		o.config.Account = account
+		return nil
+	}
+}
+
+func WithUser(user string) Option {
+	return func(o *options) error {
+		o.config.User = user
+		return nil
+	}
+}
+
+func WithDatabase(database string) Option {
+	return func(o *options) error {
+		o.config.Database = database
+		return nil
+	}
+}
+
+func WithSchema(schema string) Option {
+	return func(o *options) error {
+		o.config.Schema = schema
+		return nil
+	}
+}
+
+// WithDefaultWarehouse sets the warehouse sessions start on
+func WithDefaultWarehouse(warehouse string) Option {
+	return func(o *options) error {
+		o.config.Warehouse = warehouse
+		return nil
+	}
+}
+
+// WithDefaultRole sets the role sessions start with
+func WithDefaultRole(role string) Option {
+	return func(o *options) error {
+		o.config.Role = role
+		return nil
+	}
+}
+
+// WithPassword selects username/password authentication
+func WithPassword(password string) Option {
+	return func(o *options) error {
+		o.setAuth(authPassword)
+		o.config.Password = password
+		return nil
+	}
+}
+
+// WithPrivateKey selects key-pair authentication with an unencrypted PEM key
+func WithPrivateKey(privateKeyPEM string) Option {
+	return WithEncryptedPrivateKey(privateKeyPEM, "")
+}
+
+// WithEncryptedPrivateKey selects key-pair authentication with a PEM key, decrypted with passphrase if needed
+func WithEncryptedPrivateKey(privateKeyPEM, passphrase string) Option {
+	return func(o *options) error {
+		o.setAuth(authKeyPair)
+		o.privateKeyPEM = privateKeyPEM
+		o.passphrase = passphrase
+		return nil
+	}
+}
+
+// WithSecondaryPrivateKey adds a fallback key for zero-downtime rotation, the connector switches to it when
+// Snowflake rejects the primary key, see RotatingConnector
+func WithSecondaryPrivateKey(privateKeyPEM, passphrase string) Option {
+	return func(o *options) error {
+		o.secondaryPEM = privateKeyPEM
+		o.secondaryPass = passphrase
+		return nil
+	}
+}
+
+// WithKeySource selects key-pair authentication with the key resolved from source each time a new
+// physical connection is opened
+func WithKeySource(source KeySource) Option {
+	return func(o *options) error {
+		o.setAuth(authKeySource)
+		o.keySource = source
+		return nil
+	}
+}
+
+// WithOAuth selects OAuth authentication with access tokens from provider
+func WithOAuth(provider TokenProvider) Option {
+	return func(o *options) error {
+		o.setAuth(authOAuth)
+		o.tokenProvider = provider
+		return nil
+	}
+}
+
+// WithPAT selects programmatic access token authentication with tokens from provider
+func WithPAT(provider TokenProvider) Option {
+	return func(o *options) error {
+		o.setAuth(authPAT)
+		o.tokenProvider = provider
+		return nil
+	}
+}
+
+func WithLoginTimeout(timeout time.Duration) Option {
+	return func(o *options) error {
+		if timeout < 0 {
+			return fmt.Errorf("%w: login timeout cannot be negative", ErrInvalidOption)
+		}
+		o.config.LoginTimeout = timeout
+		return nil
+	}
+}
+
+// WithClientSessionKeepAlive keeps the session alive with heartbeats instead of expiring after 4 hours of inactivity
+func WithClientSessionKeepAlive(keepAlive bool) Option {
+	return func(o *options) error {
+		o.setParam("client_session_keep_alive", strconv.FormatBool(keepAlive))
+		return nil
+	}
+}
+
+// WithApplication sets the application name reported to Snowflake
+func WithApplication(application string) Option {
+	return func(o *options) error {
+		o.config.Application = application
+		return nil
+	}
+}
+
+// WithHost overrides the host derived from the account, e.g. for private link endpoints
+func WithHost(host string) Option {
+	return func(o *options) error {
+		o.config.Host = host
+		return nil
+	}
+}
+
+func WithPort(port int) Option {
+	return func(o *options) error {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("%w: port %d is out of range", ErrInvalidOption, port)
+		}
+		o.config.Port = port
+		return nil
+	}
+}
+
+func WithProtocol(protocol string) Option {
+	return func(o *options) error {
+		if protocol != "http" && protocol != "https" {
+			return fmt.Errorf("%w: protocol must be http or https, got '%s'", ErrInvalidOption, protocol)
+		}
+		o.config.Protocol = protocol
+		return nil
+	}
+}
+
+func WithOCSPMode(mode OCSPMode) Option {
+	return func(o *options) error {
+		switch mode {
+		case OCSPFailOpen:
+			o.config.OCSPFailOpen = gosnowflake.OCSPFailOpenTrue
+			o.config.DisableOCSPChecks = false
+		case OCSPFailClosed:
+			o.config.OCSPFailOpen = gosnowflake.OCSPFailOpenFalse
+			o.config.DisableOCSPChecks = false
+		case OCSPDisabled:
+			o.config.DisableOCSPChecks = true
+		default:
+			return fmt.Errorf("%w: unknown OCSP mode %d", ErrInvalidOption, mode)
+		}
+		return nil
+	}
+}
+
+// WithSessionParams sets session parameters such as QUERY_TAG or TIMEZONE on every pooled connection,
+// names are checked against the known Snowflake session parameters
+func WithSessionParams(params map[string]string) Option {
+	return func(o *options) error {
+		if _, err := alterSessionSQL(params); err != nil {
+			return err
+		}
+		if o.sessionParams == nil {
+			o.sessionParams = map[string]string{}
+		}
+		for name, value := range params {
+			o.sessionParams[name] = value
+		}
+		return nil
+	}
+}
+
+// WithRetryPolicy retries idempotent statements that fail with transient errors such as an expired session
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(o *options) error {
+		if err := policy.validate(); err != nil {
+			return err
+		}
+		o.retry = &policy
+		return nil
+	}
+}
@@ -0,0 +1,109 @@
+package snowflake_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	snowflake "github.com/vonix/gorm-snowflake"
+)
+
+func TestOpenWithOptions_KeyPair(t *testing.T) {
+	dialector, err := snowflake.OpenWithOptions(
+		snowflake.WithAccount("test-account"),
+		snowflake.WithUser("test-user"),
+		snowflake.WithPrivateKey(generateTestRSAKey(t)),
+		snowflake.WithDatabase("test-database"),
+		snowflake.WithSchema("test-schema"),
+		snowflake.WithDefaultWarehouse("test-warehouse"),
+		snowflake.WithDefaultRole("test-role"),
+		snowflake.WithLoginTimeout(30*time.Second),
+		snowflake.WithClientSessionKeepAlive(true),
+		snowflake.WithApplication("test-app"),
+		snowflake.WithHost("test-account.privatelink.snowflakecomputing.com"),
+		snowflake.WithPort(443),
+		snowflake.WithOCSPMode(snowflake.OCSPFailClosed),
+	)
+	require.NoError(t, err)
+
+	d, ok := dialector.(*snowflake.Dialector)
+	require.True(t, ok)
+	require.NotNil(t, d.Connector)
+	require.Equal(t, "snowflake", d.Name())
+}
+
+func TestOpenWithOptions_Password(t *testing.T) {
+	_, err := snowflake.OpenWithOptions(
+		snowflake.WithAccount("test-account"),
+		snowflake.WithUser("test-user"),
+		snowflake.WithPassword("secret"),
+		snowflake.WithDatabase("test-database"),
+	)
+	require.NoError(t, err)
+}
+
+func TestOpenWithOptions_Errors(t *testing.T) {
+	validPEMKey := generateTestRSAKey(t)
+	required := []snowflake.Option{
+		snowflake.WithAccount("test-account"),
+		snowflake.WithUser("test-user"),
+		snowflake.WithDatabase("test-database"),
+	}
+
+	testCases := []struct {
+		name        string
+		opts        []snowflake.Option
+		expectedErr error
+	}{
+		{
+			name:        "missing account",
+			opts:        []snowflake.Option{snowflake.WithUser("test-user"), snowflake.WithDatabase("test-database"), snowflake.WithPassword("secret")},
+			expectedErr: snowflake.ErrInvalidAccount,
+		},
+		{
+			name:        "missing database",
+			opts:        []snowflake.Option{snowflake.WithAccount("test-account"), snowflake.WithUser("test-user"), snowflake.WithPassword("secret")},
+			expectedErr: snowflake.ErrInvalidDatabase,
+		},
+		{
+			name:        "no authentication",
+			opts:        required,
+			expectedErr: snowflake.ErrMissingCredentials,
+		},
+		{
+			name:        "empty password",
+			opts:        append(required[:3:3], snowflake.WithPassword("  ")),
+			expectedErr: snowflake.ErrMissingCredentials,
+		},
+		{
+			name:        "password and key",
+			opts:        append(required[:3:3], snowflake.WithPassword("secret"), snowflake.WithPrivateKey(validPEMKey)),
+			expectedErr: snowflake.ErrConflictingAuthentication,
+		},
+		{
+			name:        "invalid key",
+			opts:        append(required[:3:3], snowflake.WithPrivateKey("not-a-key")),
+			expectedErr: snowflake.ErrMalformedPEMBlock,
+		},
+		{
+			name:        "port out of range",
+			opts:        append(required[:3:3], snowflake.WithPassword("secret"), snowflake.WithPort(70000)),
+			expectedErr: snowflake.ErrInvalidOption,
+		},
+		{
+			name:        "negative login timeout",
+			opts:        append(required[:3:3], snowflake.WithPassword("secret"), snowflake.WithLoginTimeout(-time.Second)),
+			expectedErr: snowflake.ErrInvalidOption,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := snowflake.OpenWithOptions(tc.opts...)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("expected error %v, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package snowflake
+
+import (
+	"errors"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrOverwriteConflict  = errors.New("INSERT OVERWRITE cannot be combined with ON CONFLICT")
+	ErrOverwriteInBatches = errors.New("INSERT OVERWRITE cannot be combined with CreateInBatches, use OverwriteInBatches")
+)
+
+const overwriteModifier = "OVERWRITE"
+
+// Overwrite makes Create replace the rows of the table with the ones it inserts, atomically:
+//
+//	db.Clauses(snowflake.Overwrite()).Create(&snapshot)
+//	// INSERT OVERWRITE INTO SNAPSHOTS ...
+//
+// A Create split into several statements overwrites with the first one and appends the others, in a transaction
+// even with SkipDefaultTransaction. The rows must be passed by pointer, CreateInBatches is rejected because each of
+// its batches would replace the table, OverwriteInBatches inserts batches instead.
+func Overwrite() clause.Expression {
+	return overwriteClause{Insert: clause.Insert{Modifier: overwriteModifier}}
+}
+
+// OverwriteInBatches replaces the rows of the table with value, a slice of structs, inserted batchSize rows at a
+// time. The first batch overwrites and the others append, in a transaction even with SkipDefaultTransaction.
+func OverwriteInBatches(db *gorm.DB, value interface{}, batchSize int) (rowsAffected int64, err error) {
+	rows := reflect.Indirect(reflect.ValueOf(value))
+	if rows.Kind() != reflect.Slice {
+		result := db.Clauses(Overwrite()).Create(value)
+		return result.RowsAffected, result.Error
+	}
+
+	// a batch shares the rows' backing array, generated values are written back to them
+	batch := func(start, end int) interface{} {
+		batch := reflect.New(rows.Type())
+		batch.Elem().Set(rows.Slice(start, end))
+		return batch.Interface()
+	}
+	if batchSize <= 0 || rows.Len() <= batchSize {
+		result := db.Clauses(Overwrite()).Create(batch(0, rows.Len()))
+		return result.RowsAffected, result.Error
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for start := 0; start < rows.Len(); start += batchSize {
+			create := tx
+			if start == 0 {
+				create = tx.Clauses(Overwrite())
+			}
+			result := create.Create(batch(start, min(start+batchSize, rows.Len())))
+			if result.Error != nil {
+				return result.Error
+			}
+			rowsAffected += result.RowsAffected
+		}
+		return nil
+	})
+	return rowsAffected, err
+}
+
+// overwriteClause is the INSERT clause of Overwrite
+type overwriteClause struct {
+	clause.Insert
+}
+
+// MergeClause keeps the clause itself, clause.Insert would replace it with a plain clause.Insert
+func (overwrite overwriteClause) MergeClause(c *clause.Clause) {
+	if insert, ok := c.Expression.(clause.Insert); ok && overwrite.Table.Name == "" {
+		overwrite.Table = insert.Table
+	}
+	c.Expression = overwrite
+}
+
+func isOverwrite(stmt *gorm.Statement) bool {
+	_, ok := stmt.Clauses["INSERT"].Expression.(overwriteClause)
+	return ok
+}
+
+// isBatch reports whether the statement's rows are a slice passed by value, as CreateInBatches passes its batches
+func isBatch(stmt *gorm.Statement) bool {
+	kind := reflect.ValueOf(stmt.Dest).Kind()
+	return kind == reflect.Slice || kind == reflect.Array
+}
+
+// appendAfterOverwrite turns the statement's INSERT OVERWRITE into a plain INSERT, for the chunks after the first
+func appendAfterOverwrite(stmt *gorm.Statement) {
+	if overwrite, ok := stmt.Clauses["INSERT"].Expression.(overwriteClause); ok {
+		insert := overwrite.Insert
+		insert.Modifier = ""
+		// clause.Insert keeps the modifier it merges with, the clause is replaced instead
+		stmt.Clauses["INSERT"] = clause.Clause{Name: "INSERT", Expression: insert}
+	}
+}
+
+// splitsOverwrite reports whether an overwriting Create outside a transaction is split into several statements,
+// which only replace the table together
+func splitsOverwrite(db *gorm.DB, values clause.Values, limits createLimits, render func(clause.Values)) bool {
+	if _, ok := db.Statement.ConnPool.(gorm.TxCommitter); ok {
+		return false
+	}
+
+	resetCreateStatement(db)
+	render(values)
+	defer resetCreateStatement(db)
+	return len(values.Values) > 1 && limits.exceededBy(db.Statement)
+}
+
+// createInTransaction runs create in a new transaction on the statement's ConnPool
+func createInTransaction(db *gorm.DB, create func()) {
+	tx := db.Begin()
+	if tx.Error != nil {
+		_ = db.AddError(tx.Error)
+		return
+	}
+
+	pool := db.Statement.ConnPool
+	db.Statement.ConnPool = tx.Statement.ConnPool
+	defer func() { db.Statement.ConnPool = pool }()
+
+	create()
+	if db.Error != nil {
+		tx.Rollback()
+		return
+	}
+	_ = db.AddError(tx.Commit().Error)
+}
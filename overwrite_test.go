@@ -0,0 +1,133 @@
+package snowflake_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+	snowflake "github.com/vonix/gorm-snowflake"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func TestOverwrite_EmitsInsertOverwriteWithoutArrayBinds(t *testing.T) {
+	db, dialector := openArrayBind(t, 2)
+
+	listings := []Listing{{Source: "crm", ExternalID: "1", Title: "a"}, {Source: "crm", ExternalID: "2", Title: "b"}}
+	require.NoError(t, db.Clauses(snowflake.Overwrite()).Create(&listings).Error)
+
+	statements := dialector.Statements()
+	require.Len(t, statements, 1)
+	require.Equal(t, "INSERT OVERWRITE INTO LISTINGS (SOURCE,EXTERNAL_ID,TITLE) VALUES (?,?,?),(?,?,?);", statements[0].SQL)
+}
+
+func TestOverwrite_OverwritesWithFirstChunkOnly(t *testing.T) {
+	// the chunks replace the table together, in a transaction even with SkipDefaultTransaction
+	db, mock := openMock(t, snowflake.Config{MaxBindVars: 6}, &gorm.Config{SkipDefaultTransaction: true})
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT OVERWRITE INTO LISTINGS (SOURCE,EXTERNAL_ID,TITLE) VALUES (?,?,?);").
+		WithArgs("crm", "1", "a").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	for _, id := range []string{"2", "3"} {
+		mock.ExpectExec("INSERT INTO LISTINGS (SOURCE,EXTERNAL_ID,TITLE) VALUES (?,?,?);").
+			WithArgs("crm", id, "a").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+
+	listings := []Listing{
+		{Source: "crm", ExternalID: "1", Title: "a"},
+		{Source: "crm", ExternalID: "2", Title: "a"},
+		{Source: "crm", ExternalID: "3", Title: "a"},
+	}
+	result := db.Clauses(snowflake.Overwrite()).Create(&listings)
+	require.NoError(t, result.Error)
+	require.Equal(t, int64(3), result.RowsAffected)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOverwrite_RollsBackFailedChunks(t *testing.T) {
+	db, mock := openMock(t, snowflake.Config{MaxBindVars: 3}, &gorm.Config{SkipDefaultTransaction: true})
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT OVERWRITE INTO LISTINGS (SOURCE,EXTERNAL_ID,TITLE) VALUES (?,?,?);").
+		WithArgs("crm", "1", "a").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO LISTINGS (SOURCE,EXTERNAL_ID,TITLE) VALUES (?,?,?);").
+		WithArgs("crm", "2", "a").
+		WillReturnError(errors.New("warehouse suspended"))
+	mock.ExpectRollback()
+
+	listings := []Listing{{Source: "crm", ExternalID: "1", Title: "a"}, {Source: "crm", ExternalID: "2", Title: "a"}}
+	require.Error(t, db.Clauses(snowflake.Overwrite()).Create(&listings).Error)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOverwrite_RejectsCreateInBatches(t *testing.T) {
+	db, mock := openMock(t, snowflake.Config{}, &gorm.Config{SkipDefaultTransaction: true})
+
+	listings := []Listing{{Source: "crm", ExternalID: "1", Title: "a"}, {Source: "crm", ExternalID: "2", Title: "a"}}
+	err := db.Clauses(snowflake.Overwrite()).CreateInBatches(&listings, 1).Error
+	require.ErrorIs(t, err, snowflake.ErrOverwriteInBatches)
+
+	// a part of the rows passed by value looks like a batch, it would not replace the table with all of them
+	overwrite := db.Clauses(snowflake.Overwrite()).Session(&gorm.Session{})
+	require.ErrorIs(t, overwrite.Create(listings[:1]).Error, snowflake.ErrOverwriteInBatches)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOverwriteInBatches_AppendsLaterBatchesInTransaction(t *testing.T) {
+	db, mock := openMock(t, snowflake.Config{}, &gorm.Config{SkipDefaultTransaction: true})
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT OVERWRITE INTO LISTINGS (SOURCE,EXTERNAL_ID,TITLE) VALUES (?,?,?),(?,?,?);").
+		WithArgs("crm", "1", "a", "crm", "2", "a").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("INSERT INTO LISTINGS (SOURCE,EXTERNAL_ID,TITLE) VALUES (?,?,?);").
+		WithArgs("crm", "3", "a").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	// a single batch needs no transaction
+	mock.ExpectExec("INSERT OVERWRITE INTO LISTINGS (SOURCE,EXTERNAL_ID,TITLE) VALUES (?,?,?),(?,?,?),(?,?,?);").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	listings := []Listing{
+		{Source: "crm", ExternalID: "1", Title: "a"},
+		{Source: "crm", ExternalID: "2", Title: "a"},
+		{Source: "crm", ExternalID: "3", Title: "a"},
+	}
+	rows, err := snowflake.OverwriteInBatches(db, &listings, 2)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), rows)
+
+	rows, err = snowflake.OverwriteInBatches(db, listings, 3)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), rows)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOverwriteInBatches_RollsBackFailedBatches(t *testing.T) {
+	db, mock := openMock(t, snowflake.Config{}, &gorm.Config{SkipDefaultTransaction: true})
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT OVERWRITE INTO LISTINGS (SOURCE,EXTERNAL_ID,TITLE) VALUES (?,?,?);").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO LISTINGS (SOURCE,EXTERNAL_ID,TITLE) VALUES (?,?,?);").
+		WillReturnError(errors.New("warehouse suspended"))
+	mock.ExpectRollback()
+
+	listings := []Listing{{Source: "crm", ExternalID: "1", Title: "a"}, {Source: "crm", ExternalID: "2", Title: "a"}}
+	_, err := snowflake.OverwriteInBatches(db, &listings, 1)
+	require.Error(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOverwrite_RejectsOnConflict(t *testing.T) {
+	db, dialector := openOffline(t)
+
+	err := db.Clauses(snowflake.Overwrite(), clause.OnConflict{UpdateAll: true}).Create(&Listing{ID: 1, Source: "crm"}).Error
+	require.ErrorIs(t, err, snowflake.ErrOverwriteConflict)
+	require.Empty(t, dialector.Statements())
+}
@@ -0,0 +1,222 @@
+package snowflake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrProfileNotFound          = errors.New("connection profile not found")
+	ErrUnsupportedAuthenticator = errors.New("unsupported authenticator")
+)
+
+const defaultProfileName = "default"
+
+// profileKeys are the connections.toml keys OpenProfile understands, each can be overridden from the environment
+var profileKeys = []string{
+	"account",
+	"user",
+	"password",
+	"authenticator",
+	"private_key_file",
+	"private_key_path",
+	"private_key_file_pwd",
+	"token",
+	"token_file_path",
+	"database",
+	"schema",
+	"warehouse",
+	"role",
+	"host",
+	"port",
+}
+
+// OpenProfile builds a dialector from a named connection in the connections.toml file shared with
+// SnowSQL and the Snowflake CLI. The file is $SNOWFLAKE_HOME/connections.toml when SNOWFLAKE_HOME is set,
+// ~/.snowflake/connections.toml otherwise. An empty name falls back to $SNOWFLAKE_DEFAULT_CONNECTION_NAME,
+// then to "default".
+//
+// Every key can be overridden from the environment, highest precedence first:
+//
+//  1. SNOWFLAKE_CONNECTIONS_<NAME>_<KEY>, e.g. SNOWFLAKE_CONNECTIONS_PROD_WAREHOUSE
+//  2. SNOWFLAKE_<KEY>, e.g. SNOWFLAKE_WAREHOUSE
+//  3. the [<name>] table in connections.toml
+//
+// A missing file is not an error as long as the environment provides the connection. The authenticator may be
+// SNOWFLAKE (password), SNOWFLAKE_JWT (key pair), OAUTH or PROGRAMMATIC_ACCESS_TOKEN (token or token_file_path),
+// when it is omitted a private_key_file implies SNOWFLAKE_JWT.
+func OpenProfile(name string) (gorm.Dialector, error) {
+	path, err := connectionsFilePath()
+	if err != nil {
+		return nil, err
+	}
+	return OpenProfileFile(path, name)
+}
+
+// OpenProfileFile works like OpenProfile but reads the connections from path
+func OpenProfileFile(path, name string) (gorm.Dialector, error) {
+	settings, err := loadProfile(path, name)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := profileOptions(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	return OpenWithOptions(opts...)
+}
+
+func connectionsFilePath() (string, error) {
+	if home := os.Getenv("SNOWFLAKE_HOME"); home != "" {
+		return filepath.Join(home, "connections.toml"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate connections.toml: %w", err)
+	}
+	return filepath.Join(home, ".snowflake", "connections.toml"), nil
+}
+
+func loadProfile(path, name string) (map[string]string, error) {
+	if name == "" {
+		name = os.Getenv("SNOWFLAKE_DEFAULT_CONNECTION_NAME")
+	}
+	if name == "" {
+		name = defaultProfileName
+	}
+
+	var connections map[string]map[string]interface{}
+	if _, err := toml.DecodeFile(path, &connections); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read connection profiles from %s: %w", path, err)
+	}
+
+	settings := map[string]string{}
+	section, found := connections[name]
+	for key, value := range section {
+		settings[strings.ToLower(key)] = fmt.Sprint(value)
+	}
+
+	envPrefix := "SNOWFLAKE_CONNECTIONS_" + strings.ToUpper(name) + "_"
+	for _, key := range profileKeys {
+		envKey := strings.ToUpper(key)
+		if value, ok := os.LookupEnv(envPrefix + envKey); ok {
+			settings[key] = value
+			found = true
+		} else if value, ok := os.LookupEnv("SNOWFLAKE_" + envKey); ok {
+			settings[key] = value
+			found = true
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf("%w: no connection named '%s' in %s or the environment", ErrProfileNotFound, name, path)
+	}
+
+	return settings, nil
+}
+
+func profileOptions(settings map[string]string) ([]Option, error) {
+	opts := []Option{
+		WithAccount(settings["account"]),
+		WithUser(settings["user"]),
+		WithDatabase(settings["database"]),
+		WithSchema(settings["schema"]),
+		WithDefaultWarehouse(settings["warehouse"]),
+		WithDefaultRole(settings["role"]),
+	}
+
+	if host := settings["host"]; host != "" {
+		opts = append(opts, WithHost(host))
+	}
+
+	if port := settings["port"]; port != "" {
+		p, err := strconv.Atoi(port)
+		if err != nil {
+			return nil, fmt.Errorf("%w: port '%s' is not a number", ErrInvalidOption, port)
+		}
+		opts = append(opts, WithPort(p))
+	}
+
+	keyFile := settings["private_key_file"]
+	if keyFile == "" {
+		keyFile = settings["private_key_path"]
+	}
+
+	authenticator := strings.ToUpper(settings["authenticator"])
+	if authenticator == "" && keyFile != "" {
+		authenticator = "SNOWFLAKE_JWT"
+	}
+
+	switch authenticator {
+	case "", "SNOWFLAKE":
+		opts = append(opts, WithPassword(settings["password"]))
+	case "SNOWFLAKE_JWT":
+		if err := validateRequired(keyFile, "private_key_file", ErrEmptyPrivateKey); err != nil {
+			return nil, err
+		}
+
+		privateKeyPEM, err := os.ReadFile(expandHome(keyFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read private key file: %w", err)
+		}
+		opts = append(opts, WithEncryptedPrivateKey(string(privateKeyPEM), settings["private_key_file_pwd"]))
+	case "OAUTH", "PROGRAMMATIC_ACCESS_TOKEN":
+		provider, err := profileToken(settings)
+		if err != nil {
+			return nil, err
+		}
+
+		if authenticator == "OAUTH" {
+			opts = append(opts, WithOAuth(provider))
+		} else {
+			opts = append(opts, WithPAT(provider))
+		}
+	default:
+		return nil, fmt.Errorf("%w: '%s'", ErrUnsupportedAuthenticator, settings["authenticator"])
+	}
+
+	return opts, nil
+}
+
+// profileToken reads token_file_path on every call so refreshed tokens are picked up, token is used as is
+func profileToken(settings map[string]string) (TokenProvider, error) {
+	path := settings["token_file_path"]
+	if path == "" {
+		if err := validateRequired(settings["token"], "token", ErrInvalidToken); err != nil {
+			return nil, err
+		}
+		return StaticToken(settings["token"]), nil
+	}
+
+	return TokenProviderFunc(func(ctx context.Context) (string, time.Time, error) {
+		token, err := os.ReadFile(expandHome(path))
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		return strings.TrimSpace(string(token)), time.Time{}, nil
+	}), nil
+}
+
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
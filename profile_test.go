@@ -0,0 +1,154 @@
+package snowflake_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	snowflake "github.com/vonix/gorm-snowflake"
+)
+
+func TestOpenProfile_KeyPairFromFile(t *testing.T) {
+	writeConnectionsFile(t, `
+[dev]
+account = "test-account"
+user = "test-user"
+authenticator = "SNOWFLAKE_JWT"
+private_key_file = "{{KEY}}"
+database = "test-database"
+schema = "test-schema"
+warehouse = "test-warehouse"
+role = "test-role"
+port = 443
+`)
+
+	dialector, err := snowflake.OpenProfile("dev")
+	require.NoError(t, err)
+	require.NotNil(t, dialector.(*snowflake.Dialector).Connector)
+}
+
+func TestOpenProfile_DefaultName(t *testing.T) {
+	writeConnectionsFile(t, `
+[default]
+account = "test-account"
+user = "test-user"
+password = "secret"
+database = "test-database"
+`)
+
+	_, err := snowflake.OpenProfile("")
+	require.NoError(t, err)
+
+	t.Setenv("SNOWFLAKE_DEFAULT_CONNECTION_NAME", "other")
+	_, err = snowflake.OpenProfile("")
+	require.ErrorIs(t, err, snowflake.ErrProfileNotFound)
+}
+
+func TestOpenProfile_EnvironmentPrecedence(t *testing.T) {
+	writeConnectionsFile(t, `
+[dev]
+account = "test-account"
+user = "test-user"
+password = "secret"
+`)
+
+	_, err := snowflake.OpenProfile("dev")
+	require.ErrorIs(t, err, snowflake.ErrInvalidDatabase)
+
+	t.Setenv("SNOWFLAKE_DATABASE", "test-database")
+	_, err = snowflake.OpenProfile("dev")
+	require.NoError(t, err)
+
+	// the connection specific variable wins over the generic one
+	t.Setenv("SNOWFLAKE_CONNECTIONS_DEV_DATABASE", "   ")
+	_, err = snowflake.OpenProfile("dev")
+	require.ErrorIs(t, err, snowflake.ErrInvalidDatabase)
+	require.Contains(t, err.Error(), "database cannot be only whitespace")
+}
+
+func TestOpenProfile_EnvironmentOnly(t *testing.T) {
+	clearSnowflakeEnv(t)
+	t.Setenv("SNOWFLAKE_HOME", t.TempDir())
+	t.Setenv("SNOWFLAKE_ACCOUNT", "test-account")
+	t.Setenv("SNOWFLAKE_USER", "test-user")
+	t.Setenv("SNOWFLAKE_PASSWORD", "secret")
+	t.Setenv("SNOWFLAKE_DATABASE", "test-database")
+
+	_, err := snowflake.OpenProfile("ci")
+	require.NoError(t, err)
+}
+
+func TestOpenProfile_Errors(t *testing.T) {
+	testCases := []struct {
+		name        string
+		profile     string
+		contents    string
+		expectedErr error
+	}{
+		{
+			name:        "unknown profile",
+			profile:     "missing",
+			contents:    "[dev]\naccount = \"test-account\"\n",
+			expectedErr: snowflake.ErrProfileNotFound,
+		},
+		{
+			name:        "unsupported authenticator",
+			profile:     "dev",
+			contents:    "[dev]\naccount = \"test-account\"\nuser = \"test-user\"\ndatabase = \"test-database\"\nauthenticator = \"externalbrowser\"\n",
+			expectedErr: snowflake.ErrUnsupportedAuthenticator,
+		},
+		{
+			name:        "missing private key file",
+			profile:     "dev",
+			contents:    "[dev]\naccount = \"test-account\"\nuser = \"test-user\"\ndatabase = \"test-database\"\nauthenticator = \"SNOWFLAKE_JWT\"\n",
+			expectedErr: snowflake.ErrEmptyPrivateKey,
+		},
+		{
+			name:        "missing user",
+			profile:     "dev",
+			contents:    "[dev]\naccount = \"test-account\"\npassword = \"secret\"\ndatabase = \"test-database\"\n",
+			expectedErr: snowflake.ErrInvalidUser,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			writeConnectionsFile(t, tc.contents)
+
+			_, err := snowflake.OpenProfile(tc.profile)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("expected error %v, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+// writeConnectionsFile points SNOWFLAKE_HOME at a temp dir holding contents as connections.toml,
+// {{KEY}} is replaced with the path of a freshly generated private key file
+func writeConnectionsFile(t *testing.T, contents string) {
+	t.Helper()
+	clearSnowflakeEnv(t)
+
+	home := t.TempDir()
+	keyPath := filepath.Join(home, "rsa_key.p8")
+	require.NoError(t, os.WriteFile(keyPath, []byte(generateTestRSAKey(t)), 0o600))
+
+	contents = strings.ReplaceAll(contents, "{{KEY}}", filepath.ToSlash(keyPath))
+	require.NoError(t, os.WriteFile(filepath.Join(home, "connections.toml"), []byte(contents), 0o600))
+
+	t.Setenv("SNOWFLAKE_HOME", home)
+}
+
+func clearSnowflakeEnv(t *testing.T) {
+	t.Helper()
+	for _, kv := range os.Environ() {
+		if key, _, _ := strings.Cut(kv, "="); strings.HasPrefix(key, "SNOWFLAKE_") {
+			// Setenv registers the restore, Unsetenv makes the variable absent for the test
+			t.Setenv(key, "")
+			os.Unsetenv(key)
+		}
+	}
+}
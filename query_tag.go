@@ -0,0 +1,153 @@
+package snowflake
+
+import (
+	"context"
+	"encoding/json"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/snowflakedb/gosnowflake"
+	"gorm.io/gorm"
+)
+
+// maxQueryTagLength is the longest QUERY_TAG Snowflake accepts
+const maxQueryTagLength = 2000
+
+type queryTagsKey struct{}
+
+type queryTagKey struct{}
+
+// WithQueryTags adds tags to the QUERY_TAG that QueryTagger sets for statements run with ctx
+func WithQueryTags(ctx context.Context, tags map[string]string) context.Context {
+	merged := map[string]string{}
+	if existing, ok := ctx.Value(queryTagsKey{}).(map[string]string); ok {
+		for key, value := range existing {
+			merged[key] = value
+		}
+	}
+	for key, value := range tags {
+		merged[key] = value
+	}
+	return context.WithValue(ctx, queryTagsKey{}, merged)
+}
+
+// QueryTagFromContext returns the QUERY_TAG QueryTagger set on a statement context
+func QueryTagFromContext(ctx context.Context) (string, bool) {
+	tag, ok := ctx.Value(queryTagKey{}).(string)
+	return tag, ok
+}
+
+// QueryTagger is a gorm plugin that sets QUERY_TAG on every statement to a JSON document describing where it
+// came from, so QUERY_HISTORY can be grouped by service, model and call site:
+//
+//	db.Use(&snowflake.QueryTagger{Service: "billing"})
+//
+// The tag travels with the query request, it costs no extra round trip.
+type QueryTagger struct {
+	Service string
+	// Tags are added to every statement, tags from WithQueryTags take precedence
+	Tags map[string]string
+}
+
+type queryTag struct {
+	Service   string            `json:"service,omitempty"`
+	Operation string            `json:"operation"`
+	Table     string            `json:"table,omitempty"`
+	Caller    string            `json:"caller,omitempty"`
+	Tags      map[string]string `json:"tags,omitempty"`
+}
+
+func (t *QueryTagger) Name() string {
+	return "snowflake:query_tag"
+}
+
+// Initialize registers the stamp ahead of every callback, including the session switch registered by the
+// dialector, so the USE statements are tagged too
+func (t *QueryTagger) Initialize(db *gorm.DB) error {
+	callback := db.Callback()
+	registrations := []error{
+		callback.Create().Before("*").Register("snowflake:query_tag", t.stamp("create")),
+		callback.Query().Before("*").Register("snowflake:query_tag", t.stamp("query")),
+		callback.Update().Before("*").Register("snowflake:query_tag", t.stamp("update")),
+		callback.Delete().Before("*").Register("snowflake:query_tag", t.stamp("delete")),
+		callback.Raw().Before("*").Register("snowflake:query_tag", t.stamp("raw")),
+		callback.Row().Before("*").Register("snowflake:query_tag", t.stamp("")),
+	}
+
+	for _, err := range registrations {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stamp returns the callback for operation, an empty operation is Row and Rows which serve both Raw and model queries
+func (t *QueryTagger) stamp(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		if db.Error != nil {
+			return
+		}
+
+		tag := queryTag{
+			Service:   t.Service,
+			Operation: operation,
+			Table:     db.Statement.Table,
+			Caller:    queryTagCaller(),
+			Tags:      t.Tags,
+		}
+
+		if tag.Operation == "" {
+			tag.Operation = "query"
+			if db.Statement.SQL.Len() > 0 {
+				tag.Operation = "raw"
+			}
+		}
+
+		if tags, ok := db.Statement.Context.Value(queryTagsKey{}).(map[string]string); ok {
+			tag.Tags = make(map[string]string, len(t.Tags)+len(tags))
+			for key, value := range t.Tags {
+				tag.Tags[key] = value
+			}
+			for key, value := range tags {
+				tag.Tags[key] = value
+			}
+		}
+
+		encoded, err := json.Marshal(tag)
+		if err == nil && len(encoded) > maxQueryTagLength {
+			// an oversized tag fails the query, keep the metadata and drop the free-form tags
+			tag.Tags = nil
+			encoded, err = json.Marshal(tag)
+		}
+		if err != nil || len(encoded) > maxQueryTagLength {
+			return
+		}
+
+		ctx := context.WithValue(db.Statement.Context, queryTagKey{}, string(encoded))
+		db.Statement.Context = gosnowflake.WithQueryTag(ctx, string(encoded))
+	}
+}
+
+// queryTagCaller returns file:line of the first frame outside gorm and this package
+func queryTagCaller() string {
+	pcs := [24]uintptr{}
+	n := runtime.Callers(3, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !isQueryTagInternalFrame(frame.Function) {
+			return frame.File + ":" + strconv.Itoa(frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+func isQueryTagInternalFrame(function string) bool {
+	return strings.HasPrefix(function, "gorm.io/gorm.") ||
+		strings.HasPrefix(function, "gorm.io/gorm/") ||
+		strings.HasPrefix(function, "github.com/vonix/gorm-snowflake.")
+}
@@ -0,0 +1,122 @@
+package snowflake_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+	snowflake "github.com/vonix/gorm-snowflake"
+	"gorm.io/gorm"
+)
+
+type decodedQueryTag struct {
+	Service   string            `json:"service"`
+	Operation string            `json:"operation"`
+	Table     string            `json:"table"`
+	Caller    string            `json:"caller"`
+	Tags      map[string]string `json:"tags"`
+}
+
+func openQueryTagged(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock := openMock(t, snowflake.Config{}, &gorm.Config{})
+	require.NoError(t, db.Use(&snowflake.QueryTagger{Service: "billing", Tags: map[string]string{"team": "finance"}}))
+	return db, mock
+}
+
+func decodeQueryTag(t *testing.T, tx *gorm.DB) decodedQueryTag {
+	t.Helper()
+
+	raw, ok := snowflake.QueryTagFromContext(tx.Statement.Context)
+	require.True(t, ok, "statement should carry a query tag")
+
+	var tag decodedQueryTag
+	require.NoError(t, json.Unmarshal([]byte(raw), &tag))
+	return tag
+}
+
+func TestQueryTagger_TagsOperations(t *testing.T) {
+	db, mock := openQueryTagged(t)
+
+	mock.ExpectQuery("SELECT * FROM USERS").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO USERS (NAME,ID) VALUES (?,?);").WithArgs("a", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec("TRUNCATE TABLE USERS").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT COUNT(*) FROM USERS").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	var users []User
+	var count int64
+	tests := []struct {
+		name      string
+		run       func() *gorm.DB
+		operation string
+		table     string
+	}{
+		{"find", func() *gorm.DB { return db.Find(&users) }, "query", "USERS"},
+		{"create", func() *gorm.DB { return db.Create(&User{ID: 1, Name: "a"}) }, "create", "USERS"},
+		{"exec", func() *gorm.DB { return db.Exec("TRUNCATE TABLE USERS") }, "raw", ""},
+		{"raw scan", func() *gorm.DB { return db.Raw("SELECT COUNT(*) FROM USERS").Scan(&count) }, "raw", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := tt.run()
+			require.NoError(t, tx.Error)
+
+			tag := decodeQueryTag(t, tx)
+			if tag.Service != "billing" {
+				t.Errorf("service = %q, want billing", tag.Service)
+			}
+			if tag.Operation != tt.operation {
+				t.Errorf("operation = %q, want %q", tag.Operation, tt.operation)
+			}
+			if tag.Table != tt.table {
+				t.Errorf("table = %q, want %q", tag.Table, tt.table)
+			}
+			if !strings.Contains(tag.Caller, "query_tag_test.go:") {
+				t.Errorf("caller = %q, want a frame in query_tag_test.go", tag.Caller)
+			}
+		})
+	}
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestQueryTagger_MergesContextTags(t *testing.T) {
+	db, mock := openQueryTagged(t)
+
+	mock.ExpectQuery("SELECT * FROM USERS").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+
+	ctx := snowflake.WithQueryTags(context.Background(), map[string]string{"job": "invoices"})
+	ctx = snowflake.WithQueryTags(ctx, map[string]string{"team": "payments"})
+
+	var users []User
+	tx := db.WithContext(ctx).Find(&users)
+	require.NoError(t, tx.Error)
+
+	tag := decodeQueryTag(t, tx)
+	require.Equal(t, map[string]string{"job": "invoices", "team": "payments"}, tag.Tags)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestQueryTagger_DropsTagsWhenTooLong(t *testing.T) {
+	db, mock := openQueryTagged(t)
+
+	mock.ExpectQuery("SELECT * FROM USERS").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+
+	ctx := snowflake.WithQueryTags(context.Background(), map[string]string{"blob": strings.Repeat("x", 2500)})
+
+	var users []User
+	tx := db.WithContext(ctx).Find(&users)
+	require.NoError(t, tx.Error)
+
+	tag := decodeQueryTag(t, tx)
+	require.Empty(t, tag.Tags)
+	require.Equal(t, "query", tag.Operation)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
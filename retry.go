@@ -0,0 +1,259 @@
+package snowflake
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/snowflakedb/gosnowflake"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultRetryAttempts  = 3
+	defaultRetryBaseDelay = 200 * time.Millisecond
+	defaultRetryMaxDelay  = 5 * time.Second
+	defaultRetryJitter    = 0.2
+)
+
+// retryableErrorCodes are Snowflake error numbers after which the statement never ran and a new attempt,
+// usually on a new session, is expected to succeed
+var retryableErrorCodes = map[int]string{
+	390111: "session no longer exists",
+	390112: "session expired",
+	390114: "authentication token expired",
+	260007: "service unavailable",
+	260008: "failed to connect",
+	608:    "warehouse is resuming",
+	610:    "statement cancelled due to overload",
+}
+
+// RetryPolicy retries statements that are safe to run twice when they fail with a transient error. Safe are
+// reads (SELECT, WITH without DML, SHOW, DESCRIBE) and CREATE or ALTER statements using IF NOT EXISTS, anything
+// else fails on the first error. Statements inside a transaction are never retried.
+type RetryPolicy struct {
+	// MaxAttempts includes the first attempt, defaults to 3
+	MaxAttempts int
+	// BaseDelay is the wait before the second attempt, it doubles with every further attempt up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Jitter randomizes each delay by up to this fraction, between 0 and 1, defaults to 0.2
+	Jitter float64
+	// RetryableCodes are Snowflake error numbers retried in addition to the defaults, e.g. codes of transient
+	// errors seen in QUERY_HISTORY
+	RetryableCodes []int
+}
+
+func (policy RetryPolicy) validate() error {
+	if policy.MaxAttempts < 0 {
+		return fmt.Errorf("%w: retry attempts cannot be negative", ErrInvalidOption)
+	}
+	if policy.BaseDelay < 0 || policy.MaxDelay < 0 {
+		return fmt.Errorf("%w: retry delays cannot be negative", ErrInvalidOption)
+	}
+	if policy.Jitter < 0 || policy.Jitter > 1 {
+		return fmt.Errorf("%w: retry jitter must be between 0 and 1, got %v", ErrInvalidOption, policy.Jitter)
+	}
+	return nil
+}
+
+func (policy RetryPolicy) withDefaults() RetryPolicy {
+	if policy.MaxAttempts == 0 {
+		policy.MaxAttempts = defaultRetryAttempts
+	}
+	if policy.BaseDelay == 0 {
+		policy.BaseDelay = defaultRetryBaseDelay
+	}
+	if policy.MaxDelay == 0 {
+		policy.MaxDelay = defaultRetryMaxDelay
+	}
+	if policy.Jitter == 0 {
+		policy.Jitter = defaultRetryJitter
+	}
+	return policy
+}
+
+func (policy RetryPolicy) delay(attempt int) time.Duration {
+	delay := policy.BaseDelay
+	for i := 1; i < attempt && delay < policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > policy.MaxDelay {
+		delay = policy.MaxDelay
+	}
+
+	spread := float64(delay) * policy.Jitter
+	return time.Duration(float64(delay) - spread + rand.Float64()*2*spread)
+}
+
+func (policy RetryPolicy) retryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var sfErr *gosnowflake.SnowflakeError
+	if errors.As(err, &sfErr) {
+		if _, ok := retryableErrorCodes[sfErr.Number]; ok {
+			return true
+		}
+		for _, code := range policy.RetryableCodes {
+			if sfErr.Number == code {
+				return true
+			}
+		}
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+var (
+	leadingSQLComments = regexp.MustCompile(`^(\s+|--[^\n]*\n?|/\*(?s:.*?)\*/)+`)
+	dmlKeyword         = regexp.MustCompile(`\b(INSERT|UPDATE|DELETE|MERGE)\b`)
+	ifNotExists        = regexp.MustCompile(`\bIF\s+NOT\s+EXISTS\b`)
+)
+
+// isIdempotentStatement reports whether running query twice has the same effect as running it once
+func isIdempotentStatement(query string) bool {
+	upper := strings.ToUpper(leadingSQLComments.ReplaceAllString(query, ""))
+	fields := strings.Fields(upper)
+	if len(fields) == 0 {
+		return false
+	}
+
+	switch strings.TrimRight(fields[0], "(;") {
+	case "SELECT", "SHOW", "DESC", "DESCRIBE":
+		return true
+	case "WITH":
+		return !dmlKeyword.MatchString(upper)
+	case "CREATE", "ALTER":
+		return ifNotExists.MatchString(upper)
+	}
+	return false
+}
+
+// retryConnPool retries idempotent statements on the wrapped pool, transactions it begins are not wrapped
+type retryConnPool struct {
+	gorm.ConnPool
+	policy RetryPolicy
+}
+
+func newRetryConnPool(pool gorm.ConnPool, policy RetryPolicy) (gorm.ConnPool, error) {
+	if err := policy.validate(); err != nil {
+		return nil, err
+	}
+	return &retryConnPool{ConnPool: pool, policy: policy.withDefaults()}, nil
+}
+
+func (p *retryConnPool) ExecContext(ctx context.Context, query string, args ...interface{}) (result sql.Result, err error) {
+	if !isIdempotentStatement(query) {
+		return p.ConnPool.ExecContext(ctx, query, args...)
+	}
+
+	err = p.retry(ctx, query, func() error {
+		result, err = p.ConnPool.ExecContext(ctx, query, args...)
+		return err
+	})
+	return result, err
+}
+
+func (p *retryConnPool) QueryContext(ctx context.Context, query string, args ...interface{}) (rows *sql.Rows, err error) {
+	if !isIdempotentStatement(query) {
+		return p.ConnPool.QueryContext(ctx, query, args...)
+	}
+
+	err = p.retry(ctx, query, func() error {
+		rows, err = p.ConnPool.QueryContext(ctx, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+func (p *retryConnPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) (row *sql.Row) {
+	if !isIdempotentStatement(query) {
+		return p.ConnPool.QueryRowContext(ctx, query, args...)
+	}
+
+	_ = p.retry(ctx, query, func() error {
+		row = p.ConnPool.QueryRowContext(ctx, query, args...)
+		return row.Err()
+	})
+	return row
+}
+
+// BeginTx retries starting the transaction, nothing has run on it yet
+func (p *retryConnPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (tx gorm.ConnPool, err error) {
+	err = p.retry(ctx, "BEGIN", func() error {
+		switch beginner := p.ConnPool.(type) {
+		case gorm.TxBeginner:
+			tx, err = beginner.BeginTx(ctx, opts)
+		case gorm.ConnPoolBeginner:
+			tx, err = beginner.BeginTx(ctx, opts)
+		default:
+			err = gorm.ErrInvalidTransaction
+		}
+		return err
+	})
+	return tx, err
+}
+
+func (p *retryConnPool) GetDBConn() (*sql.DB, error) {
+	return getDBConn(p.ConnPool)
+}
+
+func (p *retryConnPool) Ping() error {
+	return ping(p.ConnPool)
+}
+
+// getDBConn returns the *sql.DB behind a wrapped pool, so db.DB() keeps working
+func getDBConn(pool gorm.ConnPool) (*sql.DB, error) {
+	switch pool := pool.(type) {
+	case *sql.DB:
+		return pool, nil
+	case gorm.GetDBConnector:
+		return pool.GetDBConn()
+	}
+	return nil, gorm.ErrInvalidDB
+}
+
+func ping(pool gorm.ConnPool) error {
+	if pinger, ok := pool.(interface{ Ping() error }); ok {
+		return pinger.Ping()
+	}
+	return nil
+}
+
+func (p *retryConnPool) retry(ctx context.Context, query string, attempt func() error) error {
+	for n := 1; ; n++ {
+		err := attempt()
+		if n >= p.policy.MaxAttempts || !p.policy.retryable(err) {
+			return err
+		}
+
+		delay := p.policy.delay(n)
+		log.Warn().Err(err).Int("attempt", n).Dur("delay", delay).Str("sql", query).Msg("retrying statement after transient error")
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
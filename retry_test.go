@@ -0,0 +1,223 @@
+package snowflake_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/snowflakedb/gosnowflake"
+	"github.com/stretchr/testify/require"
+	snowflake "github.com/vonix/gorm-snowflake"
+	"gorm.io/gorm"
+)
+
+// flakyConnPool fails the first statements with errs before passing them on to the sqlmock database
+type flakyConnPool struct {
+	*sql.DB
+	errs  []error
+	calls int
+}
+
+func (p *flakyConnPool) nextErr() error {
+	p.calls++
+	if len(p.errs) == 0 {
+		return nil
+	}
+	err := p.errs[0]
+	p.errs = p.errs[1:]
+	return err
+}
+
+func (p *flakyConnPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if err := p.nextErr(); err != nil {
+		return nil, err
+	}
+	return p.DB.ExecContext(ctx, query, args...)
+}
+
+func (p *flakyConnPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if err := p.nextErr(); err != nil {
+		return nil, err
+	}
+	return p.DB.QueryContext(ctx, query, args...)
+}
+
+func openFlaky(t *testing.T, policy snowflake.RetryPolicy, errs ...error) (*gorm.DB, *flakyConnPool, sqlmock.Sqlmock) {
+	t.Helper()
+
+	mockDb, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	t.Cleanup(func() { mockDb.Close() })
+
+	pool := &flakyConnPool{DB: mockDb, errs: errs}
+	db, err := gorm.Open(snowflake.New(snowflake.Config{Conn: pool, Retry: &policy}), &gorm.Config{})
+	require.NoError(t, err)
+	return db, pool, mock
+}
+
+func sessionExpired() error {
+	return &gosnowflake.SnowflakeError{Number: 390112, Message: "Your session has expired. Please login again."}
+}
+
+func TestRetry_RetriesSelectAfterSessionExpired(t *testing.T) {
+	db, pool, mock := openFlaky(t, snowflake.RetryPolicy{BaseDelay: time.Millisecond}, sessionExpired())
+
+	mock.ExpectQuery("SELECT * FROM USERS").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "a"))
+
+	var users []User
+	require.NoError(t, db.Find(&users).Error)
+	require.Len(t, users, 1)
+	require.Equal(t, 2, pool.calls)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRetry_KeepsUnderlyingDB(t *testing.T) {
+	mockDb, _, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDb.Close()
+
+	db, err := gorm.Open(snowflake.New(snowflake.Config{Conn: mockDb, Retry: &snowflake.RetryPolicy{}}), &gorm.Config{})
+	require.NoError(t, err)
+
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	require.Same(t, mockDb, sqlDB)
+}
+
+func TestRetry_OnlyRetriesIdempotentStatements(t *testing.T) {
+	tests := []struct {
+		sql       string
+		retryable bool
+	}{
+		{"SELECT 1", true},
+		{"  -- report\n/* nightly */ select count(*) from users", true},
+		{"WITH t AS (SELECT 1) SELECT * FROM t", true},
+		{"SHOW TABLES", true},
+		{"DESCRIBE TABLE USERS", true},
+		{"CREATE TABLE IF NOT EXISTS USERS (ID NUMBER)", true},
+		{"CREATE SCHEMA IF\nNOT EXISTS STAGING", true},
+		{"ALTER TABLE USERS ADD COLUMN IF NOT EXISTS NAME VARCHAR", true},
+		{"CREATE TABLE USERS (ID NUMBER)", false},
+		{"INSERT INTO USERS (ID) VALUES (1)", false},
+		{"UPDATE USERS SET NAME = 'a'", false},
+		{"DELETE FROM USERS", false},
+		{"WITH t AS (SELECT 1) INSERT INTO USERS SELECT * FROM t", false},
+		{"DROP TABLE USERS", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sql, func(t *testing.T) {
+			db, pool, mock := openFlaky(t, snowflake.RetryPolicy{BaseDelay: time.Millisecond}, sessionExpired())
+			if tt.retryable {
+				mock.ExpectExec(tt.sql).WillReturnResult(sqlmock.NewResult(0, 0))
+			}
+
+			err := db.Exec(tt.sql).Error
+
+			wantCalls := 1
+			if tt.retryable {
+				wantCalls = 2
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+			if pool.calls != wantCalls {
+				t.Errorf("calls = %d, want %d", pool.calls, wantCalls)
+			}
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRetry_ClassifiesErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		retryable bool
+	}{
+		{"session expired", sessionExpired(), true},
+		{"session gone", &gosnowflake.SnowflakeError{Number: 390111}, true},
+		{"warehouse resuming", &gosnowflake.SnowflakeError{Number: 608}, true},
+		{"cancelled due to overload", &gosnowflake.SnowflakeError{Number: 610}, true},
+		{"wrapped session expired", errors.Join(errors.New("query failed"), sessionExpired()), true},
+		{"connection reset", syscall.ECONNRESET, true},
+		{"custom code", &gosnowflake.SnowflakeError{Number: 123456}, true},
+		{"object does not exist", &gosnowflake.SnowflakeError{Number: 2003}, false},
+		{"context canceled", context.Canceled, false},
+		{"plain error", errors.New("syntax error"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := snowflake.RetryPolicy{BaseDelay: time.Millisecond, RetryableCodes: []int{123456}}
+			db, pool, mock := openFlaky(t, policy, tt.err)
+			if tt.retryable {
+				mock.ExpectExec("SELECT 1").WillReturnResult(sqlmock.NewResult(0, 0))
+			}
+
+			err := db.Exec("SELECT 1").Error
+			if tt.retryable {
+				require.NoError(t, err)
+				require.Equal(t, 2, pool.calls)
+			} else {
+				require.Error(t, err)
+				require.Equal(t, 1, pool.calls)
+			}
+		})
+	}
+}
+
+func TestRetry_StopsAfterMaxAttempts(t *testing.T) {
+	db, pool, _ := openFlaky(t,
+		snowflake.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+		sessionExpired(), sessionExpired(), sessionExpired(), sessionExpired(),
+	)
+
+	var users []User
+	err := db.Find(&users).Error
+
+	var sfErr *gosnowflake.SnowflakeError
+	require.ErrorAs(t, err, &sfErr)
+	require.Equal(t, 390112, sfErr.Number)
+	require.Equal(t, 3, pool.calls)
+}
+
+func TestRetry_StopsWhenContextIsDone(t *testing.T) {
+	db, pool, _ := openFlaky(t, snowflake.RetryPolicy{MaxAttempts: 5, BaseDelay: time.Hour}, sessionExpired(), sessionExpired())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	var users []User
+	require.Error(t, db.WithContext(ctx).Find(&users).Error)
+	require.Equal(t, 1, pool.calls)
+}
+
+func TestRetry_RejectsInvalidPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy snowflake.RetryPolicy
+	}{
+		{"negative attempts", snowflake.RetryPolicy{MaxAttempts: -1}},
+		{"negative delay", snowflake.RetryPolicy{BaseDelay: -time.Second}},
+		{"jitter above one", snowflake.RetryPolicy{Jitter: 1.5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDb, _, err := sqlmock.New()
+			require.NoError(t, err)
+			defer mockDb.Close()
+
+			_, err = gorm.Open(snowflake.New(snowflake.Config{Conn: mockDb, Retry: &tt.policy}), &gorm.Config{})
+			require.ErrorIs(t, err, snowflake.ErrInvalidOption)
+
+			_, err = snowflake.OpenWithOptions(snowflake.WithRetryPolicy(tt.policy))
+			require.ErrorIs(t, err, snowflake.ErrInvalidOption)
+		})
+	}
+}
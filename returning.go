@@ -0,0 +1,270 @@
+package snowflake
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var ErrReturningUnsupported = errors.New("cannot return the generated values")
+
+// ReturningMode selects how values generated by the database, FieldsWithDefaultDBValue, are written back to the
+// structs after Create. Statements with ON CONFLICT are never written back, some of their rows are not inserted.
+type ReturningMode int
+
+const (
+	// ReturningNone leaves generated values zero, the default
+	ReturningNone ReturningMode = iota
+	// ReturningSequence pre-allocates the values of fields whose default is a sequence, e.g.
+	// `gorm:"default:(order_seq.NEXTVAL)"`, and inserts them like any other value
+	ReturningSequence
+	// ReturningChanges also reads the remaining generated values back from the table's change stream right after the
+	// insert, the table needs CHANGE_TRACKING = TRUE. Rows are lined up by the auto-increment field, which is created
+	// as IDENTITY ... ORDER, models without one cannot be read back. Create fails when the changes hold rows another
+	// session inserted in between, the values are then left zero.
+	ReturningChanges
+)
+
+const returningKey = "snowflake:returning"
+
+// returning is the write-back planned for a Create statement
+type returning struct {
+	rows   []reflect.Value
+	fields []*schema.Field
+	order  *schema.Field
+	pin    *pinnedConn
+}
+
+func registerReturningCallbacks(db *gorm.DB, mode ReturningMode) error {
+	callback := db.Callback().Create()
+	if err := callback.Before("gorm:create").Register("snowflake:allocate_sequences", func(db *gorm.DB) {
+		prepareReturning(db, mode)
+	}); err != nil {
+		return err
+	}
+	return callback.Before("gorm:save_after_associations").Register("snowflake:read_back_defaults", readBackDefaults)
+}
+
+func prepareReturning(db *gorm.DB, mode ReturningMode) {
+	if db.Error != nil || db.DryRun || db.Statement.Schema == nil || len(db.Statement.Schema.FieldsWithDefaultDBValue) == 0 {
+		return
+	}
+	if _, ok := db.Statement.Clauses["ON CONFLICT"]; ok {
+		return
+	}
+
+	rows := createdRows(db.Statement)
+	if len(rows) == 0 {
+		return
+	}
+
+	plan := &returning{rows: rows}
+	for _, field := range db.Statement.Schema.FieldsWithDefaultDBValue {
+		if sequence, ok := fieldSequence(field); ok {
+			if err := allocateSequence(db, field, sequence, rows); err != nil {
+				_ = db.AddError(fmt.Errorf("%w: allocating %s from %s: %w", ErrReturningUnsupported, field.Name, sequence, err))
+				return
+			}
+			continue
+		}
+		plan.fields = append(plan.fields, field)
+		if field.AutoIncrement && plan.order == nil {
+			plan.order = field
+		}
+	}
+
+	if mode != ReturningChanges || len(plan.fields) == 0 {
+		return
+	}
+	if plan.order == nil {
+		// without an ORDER identity rows inserted by other sessions can't be told apart from ours
+		_ = db.AddError(fmt.Errorf("%w: rows of %s cannot be lined up without an auto-increment field", ErrReturningUnsupported, db.Statement.Schema.Name))
+		return
+	}
+
+	// LAST_QUERY_ID() only sees the insert when the read back runs on the same session
+	pin, err := pinConn(db)
+	if err != nil {
+		_ = db.AddError(err)
+		return
+	}
+	plan.pin = pin
+	db.InstanceSet(returningKey, plan)
+}
+
+func readBackDefaults(db *gorm.DB) {
+	value, ok := db.InstanceGet(returningKey)
+	if !ok {
+		return
+	}
+	plan := value.(*returning)
+	defer plan.pin.release(db)
+
+	if db.Error != nil || db.RowsAffected == 0 {
+		return
+	}
+
+	stmt := &gorm.Statement{DB: db, Table: db.Statement.Table, TableExpr: db.Statement.TableExpr, Context: db.Statement.Context}
+	stmt.WriteString("SELECT ")
+	for idx, field := range plan.fields {
+		if idx > 0 {
+			stmt.WriteByte(',')
+		}
+		stmt.WriteQuoted(field.DBName)
+	}
+	stmt.WriteString(" FROM ")
+	stmt.WriteQuoted(clause.Table{Name: clause.CurrentTable})
+	stmt.WriteString(" CHANGES(INFORMATION => APPEND_ONLY) BEFORE(STATEMENT => LAST_QUERY_ID(")
+	// a Create split into chunks ran several statements, the changes start before the first one
+	if statements, ok := db.InstanceGet(createStatementsKey); ok && statements.(int) > 1 {
+		stmt.WriteString(strconv.Itoa(-statements.(int)))
+	}
+	stmt.WriteString(")) END(STATEMENT => LAST_QUERY_ID()) ORDER BY ")
+	stmt.WriteQuoted(plan.order.DBName)
+
+	rows, err := db.Statement.ConnPool.QueryContext(db.Statement.Context, stmt.SQL.String(), stmt.Vars...)
+	if err != nil {
+		_ = db.AddError(fmt.Errorf("%w: %w", ErrReturningUnsupported, err))
+		return
+	}
+	defer rows.Close()
+
+	// the values are only written back once the rows are known to be ours
+	var scanned [][]interface{}
+	for rows.Next() {
+		dest := make([]interface{}, len(plan.fields))
+		for idx, field := range plan.fields {
+			dest[idx] = reflect.New(field.FieldType).Interface()
+		}
+		if err := rows.Scan(dest...); err != nil {
+			_ = db.AddError(err)
+			return
+		}
+		scanned = append(scanned, dest)
+	}
+	if err := rows.Err(); err != nil {
+		_ = db.AddError(err)
+		return
+	}
+
+	switch {
+	case len(scanned) < int(db.RowsAffected):
+		_ = db.AddError(fmt.Errorf("%w: read back %d of %d rows, is CHANGE_TRACKING enabled on %s?", ErrReturningUnsupported, len(scanned), db.RowsAffected, db.Statement.Table))
+		return
+	case len(scanned) > int(db.RowsAffected) || len(scanned) != len(plan.rows):
+		// another session inserted into the table between the statements of the Create
+		_ = db.AddError(fmt.Errorf("%w: read back %d rows for %d inserted, %s was written concurrently", ErrReturningUnsupported, len(scanned), db.RowsAffected, db.Statement.Table))
+		return
+	}
+
+	for index, row := range plan.rows {
+		for idx, field := range plan.fields {
+			// values the caller set are kept
+			if fieldValue := field.ReflectValueOf(db.Statement.Context, row); fieldValue.IsZero() {
+				fieldValue.Set(reflect.ValueOf(scanned[index][idx]).Elem())
+			}
+		}
+	}
+}
+
+// allocateSequence fills the zero values of field with numbers from sequence, in row order
+func allocateSequence(db *gorm.DB, field *schema.Field, sequence string, rows []reflect.Value) error {
+	var targets []reflect.Value
+	for _, row := range rows {
+		if _, isZero := field.ValueOf(db.Statement.Context, row); isZero {
+			targets = append(targets, row)
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	// GENERATOR needs a constant row count, it can't be a bind variable
+	sql := "SELECT " + sequence + ".NEXTVAL FROM TABLE(GENERATOR(ROWCOUNT => " + strconv.Itoa(len(targets)) + "))"
+	result, err := db.Statement.ConnPool.QueryContext(db.Statement.Context, sql)
+	if err != nil {
+		return err
+	}
+	defer result.Close()
+
+	index := 0
+	for result.Next() && index < len(targets) {
+		if err := result.Scan(field.ReflectValueOf(db.Statement.Context, targets[index]).Addr().Interface()); err != nil {
+			return err
+		}
+		index++
+	}
+	if err := result.Err(); err != nil {
+		return err
+	}
+	if index < len(targets) {
+		return fmt.Errorf("got %d of %d values", index, len(targets))
+	}
+	return nil
+}
+
+// fieldSequence returns the sequence of a `default:seq.NEXTVAL` or `default:(seq.NEXTVAL)` field
+func fieldSequence(field *schema.Field) (string, bool) {
+	value := strings.TrimSpace(field.DefaultValue)
+	if len(value) > 1 && value[0] == '(' && value[len(value)-1] == ')' {
+		value = strings.TrimSpace(value[1 : len(value)-1])
+	}
+	if !sequenceNextval.MatchString(value) {
+		return "", false
+	}
+	return value[:len(value)-len(".NEXTVAL")], true
+}
+
+// createdRows returns the structs a Create statement inserts, in the order of its VALUES
+func createdRows(stmt *gorm.Statement) []reflect.Value {
+	switch stmt.ReflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		rows := make([]reflect.Value, 0, stmt.ReflectValue.Len())
+		for i := 0; i < stmt.ReflectValue.Len(); i++ {
+			if row := reflect.Indirect(stmt.ReflectValue.Index(i)); row.Kind() == reflect.Struct {
+				rows = append(rows, row)
+			}
+		}
+		return rows
+	case reflect.Struct:
+		return []reflect.Value{stmt.ReflectValue}
+	}
+	return nil
+}
+
+// pinnedConn is a connection taken from the pool so that consecutive statements share a session
+type pinnedConn struct {
+	pool gorm.ConnPool
+	conn *sql.Conn
+}
+
+// pinConn pins the statement to one connection, nil when it already runs on one, e.g. in a transaction
+func pinConn(db *gorm.DB) (*pinnedConn, error) {
+	pool := pinnablePool(db.Statement.ConnPool)
+	if pool == nil {
+		return nil, nil
+	}
+
+	conn, err := pool.Conn(db.Statement.Context)
+	if err != nil {
+		return nil, err
+	}
+	pin := &pinnedConn{pool: db.Statement.ConnPool, conn: conn}
+	db.Statement.ConnPool = conn
+	return pin, nil
+}
+
+func (pin *pinnedConn) release(db *gorm.DB) {
+	if pin == nil {
+		return
+	}
+	db.Statement.ConnPool = pin.pool
+	_ = pin.conn.Close()
+}
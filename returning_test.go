@@ -0,0 +1,152 @@
+package snowflake_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+	snowflake "github.com/vonix/gorm-snowflake"
+	"gorm.io/gorm"
+)
+
+type Invoice struct {
+	ID     int64 `gorm:"primaryKey;autoIncrement:false;default:(invoice_seq.NEXTVAL)"`
+	Number string
+}
+
+type Ticket struct {
+	ID       uint
+	Title    string
+	OpenedAt time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+type ApiToken struct {
+	Value string `gorm:"default:uuid_string()"`
+	Name  string
+}
+
+func TestReturning_AllocatesSequenceValuesInRowOrder(t *testing.T) {
+	db, mock := openMock(t, snowflake.Config{Returning: snowflake.ReturningSequence}, &gorm.Config{SkipDefaultTransaction: true})
+
+	mock.ExpectQuery("SELECT invoice_seq.NEXTVAL FROM TABLE(GENERATOR(ROWCOUNT => 2))").
+		WillReturnRows(sqlmock.NewRows([]string{"NEXTVAL"}).AddRow(10).AddRow(12))
+	mock.ExpectExec("INSERT INTO INVOICES (NUMBER,ID) VALUES (?,?),(?,?),(?,?);").
+		WithArgs("A-1", 10, "A-2", 5, "A-3", 12).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	invoices := []Invoice{{Number: "A-1"}, {Number: "A-2", ID: 5}, {Number: "A-3"}}
+	require.NoError(t, db.Create(&invoices).Error)
+
+	require.Equal(t, []int64{10, 5, 12}, []int64{invoices[0].ID, invoices[1].ID, invoices[2].ID})
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReturning_ReadsBackDefaultsFromChanges(t *testing.T) {
+	db, mock := openMock(t, snowflake.Config{Returning: snowflake.ReturningChanges}, &gorm.Config{SkipDefaultTransaction: true})
+	openedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectExec("INSERT INTO TICKETS (TITLE) VALUES (?),(?);").
+		WithArgs("a", "b").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectQuery("SELECT OPENED_AT,ID FROM TICKETS CHANGES(INFORMATION => APPEND_ONLY) BEFORE(STATEMENT => LAST_QUERY_ID()) END(STATEMENT => LAST_QUERY_ID()) ORDER BY ID").
+		WillReturnRows(sqlmock.NewRows([]string{"OPENED_AT", "ID"}).AddRow(openedAt, 7).AddRow(openedAt, 8))
+
+	tickets := []*Ticket{{Title: "a"}, {Title: "b"}}
+	require.NoError(t, db.Create(tickets).Error)
+
+	require.Equal(t, uint(7), tickets[0].ID)
+	require.Equal(t, uint(8), tickets[1].ID)
+	require.Equal(t, openedAt, tickets[1].OpenedAt)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReturning_ReadsBackInDefaultTransaction(t *testing.T) {
+	db, mock := openMock(t, snowflake.Config{Returning: snowflake.ReturningChanges}, &gorm.Config{})
+
+	// the changes are read before gorm commits, on the transaction's session
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO TICKETS (TITLE) VALUES (?);").WithArgs("a").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT OPENED_AT,ID FROM TICKETS CHANGES(INFORMATION => APPEND_ONLY) BEFORE(STATEMENT => LAST_QUERY_ID()) END(STATEMENT => LAST_QUERY_ID()) ORDER BY ID").
+		WillReturnRows(sqlmock.NewRows([]string{"OPENED_AT", "ID"}).AddRow(time.Time{}, 3))
+	mock.ExpectCommit()
+
+	ticket := Ticket{Title: "a"}
+	require.NoError(t, db.Create(&ticket).Error)
+
+	require.Equal(t, uint(3), ticket.ID)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReturning_RejectsRowsOfOtherSessions(t *testing.T) {
+	db, mock := openMock(t, snowflake.Config{Returning: snowflake.ReturningChanges}, &gorm.Config{SkipDefaultTransaction: true})
+
+	mock.ExpectExec("INSERT INTO TICKETS (TITLE) VALUES (?),(?);").WillReturnResult(sqlmock.NewResult(0, 2))
+	// ID 6 was given to a concurrent insert that committed while ours ran
+	mock.ExpectQuery("SELECT OPENED_AT,ID FROM TICKETS CHANGES(INFORMATION => APPEND_ONLY) BEFORE(STATEMENT => LAST_QUERY_ID()) END(STATEMENT => LAST_QUERY_ID()) ORDER BY ID").
+		WillReturnRows(sqlmock.NewRows([]string{"OPENED_AT", "ID"}).AddRow(time.Time{}, 6).AddRow(time.Time{}, 7).AddRow(time.Time{}, 8))
+
+	tickets := []Ticket{{Title: "a"}, {Title: "b"}}
+	err := db.Create(&tickets).Error
+	require.ErrorIs(t, err, snowflake.ErrReturningUnsupported)
+
+	require.Zero(t, tickets[0].ID)
+	require.Zero(t, tickets[1].ID)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReturning_WorksWithCreateInBatches(t *testing.T) {
+	db, mock := openMock(t, snowflake.Config{Returning: snowflake.ReturningChanges}, &gorm.Config{SkipDefaultTransaction: true})
+
+	for _, id := range []int{1, 3} {
+		mock.ExpectExec("INSERT INTO TICKETS (TITLE) VALUES (?),(?);").WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectQuery("SELECT OPENED_AT,ID FROM TICKETS CHANGES(INFORMATION => APPEND_ONLY) BEFORE(STATEMENT => LAST_QUERY_ID()) END(STATEMENT => LAST_QUERY_ID()) ORDER BY ID").
+			WillReturnRows(sqlmock.NewRows([]string{"OPENED_AT", "ID"}).AddRow(time.Time{}, id).AddRow(time.Time{}, id+1))
+	}
+
+	tickets := []Ticket{{Title: "a"}, {Title: "b"}, {Title: "c"}, {Title: "d"}}
+	require.NoError(t, db.CreateInBatches(&tickets, 2).Error)
+
+	for i, ticket := range tickets {
+		require.Equal(t, uint(i+1), ticket.ID)
+	}
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReturning_RejectsRowsThatCannotBeLinedUp(t *testing.T) {
+	db, mock := openMock(t, snowflake.Config{Returning: snowflake.ReturningChanges}, &gorm.Config{SkipDefaultTransaction: true})
+
+	err := db.Create(&[]ApiToken{{Name: "a"}, {Name: "b"}}).Error
+	require.ErrorIs(t, err, snowflake.ErrReturningUnsupported)
+
+	// a single row can't be told apart from concurrent inserts either
+	err = db.Create(&ApiToken{Name: "a"}).Error
+	require.ErrorIs(t, err, snowflake.ErrReturningUnsupported)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReturning_CreatesOrderedIdentity(t *testing.T) {
+	dialector := snowflake.Offline()
+	dialector.Returning = snowflake.ReturningChanges
+	db, err := gorm.Open(dialector, &gorm.Config{})
+	require.NoError(t, err)
+
+	require.NoError(t, db.AutoMigrate(&Ticket{}))
+	require.Contains(t, dialector.SQL(), "ID BIGINT IDENTITY(1,1) ORDER")
+}
+
+func TestReturning_ReadsBackAllChunks(t *testing.T) {
+	db, mock := openMock(t, snowflake.Config{Returning: snowflake.ReturningChanges, MaxBindVars: 1}, &gorm.Config{SkipDefaultTransaction: true})
+
+	mock.ExpectExec("INSERT INTO TICKETS (TITLE) VALUES (?);").WithArgs("a").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO TICKETS (TITLE) VALUES (?);").WithArgs("b").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT OPENED_AT,ID FROM TICKETS CHANGES(INFORMATION => APPEND_ONLY) BEFORE(STATEMENT => LAST_QUERY_ID(-2)) END(STATEMENT => LAST_QUERY_ID()) ORDER BY ID").
+		WillReturnRows(sqlmock.NewRows([]string{"OPENED_AT", "ID"}).AddRow(time.Time{}, 4).AddRow(time.Time{}, 5))
+
+	tickets := []Ticket{{Title: "a"}, {Title: "b"}}
+	require.NoError(t, db.Create(&tickets).Error)
+
+	require.Equal(t, uint(4), tickets[0].ID)
+	require.Equal(t, uint(5), tickets[1].ID)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
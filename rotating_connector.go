@@ -0,0 +1,118 @@
+package snowflake
+
+import (
+	"context"
+	"crypto/rsa"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/snowflakedb/gosnowflake"
+)
+
+// errCodeJWTTokenInvalid is returned by Snowflake when the JWT is not signed by any of the user's registered keys
+const errCodeJWTTokenInvalid = 390144
+
+// RotatingConnector opens connections with one of two RSA keys, matching Snowflake's RSA_PUBLIC_KEY and
+// RSA_PUBLIC_KEY_2. When the active key is rejected with "JWT token is invalid" the other key is tried and, if it
+// works, becomes the active key. Key changes only affect new physical connections, open ones keep their session.
+type RotatingConnector struct {
+	driver gosnowflake.InternalSnowflakeDriver
+	config gosnowflake.Config
+
+	mu        sync.RWMutex
+	active    *rsa.PrivateKey
+	secondary *rsa.PrivateKey
+}
+
+// NewRotatingConnector creates a connector for config that starts with primary and falls back to secondary,
+// secondary may be nil until a second key is registered with Rotate
+func NewRotatingConnector(config gosnowflake.Config, primary, secondary *rsa.PrivateKey) (*RotatingConnector, error) {
+	return newRotatingConnector(gosnowflake.SnowflakeDriver{}, config, primary, secondary)
+}
+
+func newRotatingConnector(d gosnowflake.InternalSnowflakeDriver, config gosnowflake.Config, primary, secondary *rsa.PrivateKey) (*RotatingConnector, error) {
+	if err := validatePrivateKey(primary); err != nil {
+		return nil, err
+	}
+	if secondary != nil {
+		if err := validatePrivateKey(secondary); err != nil {
+			return nil, err
+		}
+	}
+
+	config.Authenticator = gosnowflake.AuthTypeJwt
+	config.PrivateKey = nil
+
+	return &RotatingConnector{
+		driver:    d,
+		config:    config,
+		active:    primary,
+		secondary: secondary,
+	}, nil
+}
+
+func (c *RotatingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	c.mu.RLock()
+	active, secondary := c.active, c.secondary
+	c.mu.RUnlock()
+
+	conn, err := c.connect(ctx, active)
+	if err == nil || secondary == nil || !isJWTTokenInvalid(err) {
+		return conn, err
+	}
+
+	conn, fallbackErr := c.connect(ctx, secondary)
+	if fallbackErr != nil {
+		return nil, fmt.Errorf("%w: both keys were rejected: %w", ErrConnectionFailed, errors.Join(err, fallbackErr))
+	}
+
+	c.mu.Lock()
+	// only swap when nobody rotated the keys while we were connecting
+	if c.active == active && c.secondary == secondary {
+		c.active, c.secondary = secondary, active
+	}
+	c.mu.Unlock()
+
+	return conn, nil
+}
+
+func (c *RotatingConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// Rotate makes newKey the key new connections try first, the previously active key is kept as the fallback
+// until the new public key is registered with Snowflake
+func (c *RotatingConnector) Rotate(newKey *rsa.PrivateKey) error {
+	if err := validatePrivateKey(newKey); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.active.Equal(newKey) {
+		return nil
+	}
+	c.active, c.secondary = newKey, c.active
+	return nil
+}
+
+// ActiveKey returns the key new connections try first
+func (c *RotatingConnector) ActiveKey() *rsa.PrivateKey {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.active
+}
+
+func (c *RotatingConnector) connect(ctx context.Context, key *rsa.PrivateKey) (driver.Conn, error) {
+	config := c.config
+	config.PrivateKey = key
+	return gosnowflake.NewConnector(c.driver, config).Connect(ctx)
+}
+
+func isJWTTokenInvalid(err error) bool {
+	var sfErr *gosnowflake.SnowflakeError
+	return errors.As(err, &sfErr) && sfErr.Number == errCodeJWTTokenInvalid
+}
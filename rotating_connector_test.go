@@ -0,0 +1,123 @@
+package snowflake_test
+
+import (
+	"context"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/snowflakedb/gosnowflake"
+	"github.com/stretchr/testify/require"
+	snowflake "github.com/vonix/gorm-snowflake"
+)
+
+// rejectKeys fails JWT authentication for the given keys, like Snowflake does for keys that aren't registered
+func rejectKeys(rejected ...*rsa.PrivateKey) func(config gosnowflake.Config) error {
+	return func(config gosnowflake.Config) error {
+		for _, key := range rejected {
+			if config.PrivateKey.Equal(key) {
+				return &gosnowflake.SnowflakeError{Number: 390144, SQLState: "08001", Message: "JWT token is invalid."}
+			}
+		}
+		return nil
+	}
+}
+
+func openRotating(t *testing.T, d *fakeDriver, primary, secondary string) *snowflake.RotatingConnector {
+	t.Helper()
+
+	dialector, err := snowflake.OpenWithOptions(
+		snowflake.WithAccount("test-account"),
+		snowflake.WithUser("test-user"),
+		snowflake.WithDatabase("test-database"),
+		snowflake.WithPrivateKey(primary),
+		snowflake.WithSecondaryPrivateKey(secondary, ""),
+		snowflake.WithDriver(d),
+	)
+	require.NoError(t, err)
+
+	connector, ok := dialector.(*snowflake.Dialector).Connector.(*snowflake.RotatingConnector)
+	require.True(t, ok, "expected a RotatingConnector when a secondary key is set")
+	return connector
+}
+
+func TestRotatingConnector_FallsBackOnInvalidJWT(t *testing.T) {
+	primaryPEM, secondaryPEM := generateTestRSAKey(t), generateTestRSAKey(t)
+	primary, secondary := parseTestRSAKey(t, primaryPEM), parseTestRSAKey(t, secondaryPEM)
+
+	d := &fakeDriver{connect: rejectKeys(primary)}
+	connector := openRotating(t, d, primaryPEM, secondaryPEM)
+
+	_, err := connector.Connect(context.Background())
+	require.NoError(t, err)
+	require.Len(t, d.configs, 2)
+	require.True(t, secondary.Equal(d.lastConfig().PrivateKey))
+	require.True(t, secondary.Equal(connector.ActiveKey()), "the working key should become the active key")
+
+	// the next connection goes straight to the working key
+	_, err = connector.Connect(context.Background())
+	require.NoError(t, err)
+	require.Len(t, d.configs, 3)
+	require.True(t, secondary.Equal(d.lastConfig().PrivateKey))
+}
+
+func TestRotatingConnector_NoFallbackOnOtherErrors(t *testing.T) {
+	primaryPEM, secondaryPEM := generateTestRSAKey(t), generateTestRSAKey(t)
+	primary := parseTestRSAKey(t, primaryPEM)
+
+	d := &fakeDriver{connect: func(config gosnowflake.Config) error {
+		return &gosnowflake.SnowflakeError{Number: 390100, Message: "Incorrect username or password was specified."}
+	}}
+	connector := openRotating(t, d, primaryPEM, secondaryPEM)
+
+	_, err := connector.Connect(context.Background())
+	require.Error(t, err)
+	require.Len(t, d.configs, 1)
+	require.True(t, primary.Equal(connector.ActiveKey()))
+}
+
+func TestRotatingConnector_BothKeysRejected(t *testing.T) {
+	primaryPEM, secondaryPEM := generateTestRSAKey(t), generateTestRSAKey(t)
+
+	d := &fakeDriver{connect: rejectKeys(parseTestRSAKey(t, primaryPEM), parseTestRSAKey(t, secondaryPEM))}
+	connector := openRotating(t, d, primaryPEM, secondaryPEM)
+
+	_, err := connector.Connect(context.Background())
+	require.ErrorIs(t, err, snowflake.ErrConnectionFailed)
+	require.Len(t, d.configs, 2)
+}
+
+func TestRotatingConnector_Rotate(t *testing.T) {
+	primaryPEM, secondaryPEM := generateTestRSAKey(t), generateTestRSAKey(t)
+	primary := parseTestRSAKey(t, primaryPEM)
+	next := parseTestRSAKey(t, generateTestRSAKey(t))
+
+	d := &fakeDriver{}
+	connector := openRotating(t, d, primaryPEM, secondaryPEM)
+
+	_, err := connector.Connect(context.Background())
+	require.NoError(t, err)
+	require.True(t, primary.Equal(d.lastConfig().PrivateKey))
+
+	require.NoError(t, connector.Rotate(next))
+
+	_, err = connector.Connect(context.Background())
+	require.NoError(t, err)
+	require.True(t, next.Equal(d.lastConfig().PrivateKey))
+
+	// until the new public key is registered the previous key keeps connections working
+	d.connect = rejectKeys(next)
+	_, err = connector.Connect(context.Background())
+	require.NoError(t, err)
+	require.True(t, primary.Equal(d.lastConfig().PrivateKey))
+}
+
+func TestOpenWithOptions_SecondaryKeyRequiresKeyPair(t *testing.T) {
+	_, err := snowflake.OpenWithOptions(
+		snowflake.WithAccount("test-account"),
+		snowflake.WithUser("test-user"),
+		snowflake.WithDatabase("test-database"),
+		snowflake.WithPassword("secret"),
+		snowflake.WithSecondaryPrivateKey(generateTestRSAKey(t), ""),
+	)
+	require.ErrorIs(t, err, snowflake.ErrInvalidOption)
+}
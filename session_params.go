@@ -0,0 +1,174 @@
+package snowflake
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrUnknownSessionParameter  = errors.New("unknown session parameter")
+	ErrSessionParamsUnsupported = errors.New("session parameters are not supported with an existing Conn, use DSN or Connector")
+)
+
+// sessionParamType is the type of a session parameter's value, which decides how it is quoted
+type sessionParamType int
+
+const (
+	sessionParamString sessionParamType = iota
+	sessionParamNumber
+	sessionParamBoolean
+)
+
+// knownSessionParameters are the Snowflake session parameters accepted in Config.SessionParams
+var knownSessionParameters = map[string]sessionParamType{
+	"ABORT_DETACHED_QUERY":                sessionParamBoolean,
+	"AUTOCOMMIT":                          sessionParamBoolean,
+	"BINARY_INPUT_FORMAT":                 sessionParamString,
+	"BINARY_OUTPUT_FORMAT":                sessionParamString,
+	"CLIENT_TIMESTAMP_TYPE_MAPPING":       sessionParamString,
+	"DATE_INPUT_FORMAT":                   sessionParamString,
+	"DATE_OUTPUT_FORMAT":                  sessionParamString,
+	"ERROR_ON_NONDETERMINISTIC_MERGE":     sessionParamBoolean,
+	"ERROR_ON_NONDETERMINISTIC_UPDATE":    sessionParamBoolean,
+	"GEOGRAPHY_OUTPUT_FORMAT":             sessionParamString,
+	"GEOMETRY_OUTPUT_FORMAT":              sessionParamString,
+	"JSON_INDENT":                         sessionParamNumber,
+	"LOCK_TIMEOUT":                        sessionParamNumber,
+	"QUERY_TAG":                           sessionParamString,
+	"QUOTED_IDENTIFIERS_IGNORE_CASE":      sessionParamBoolean,
+	"ROWS_PER_RESULTSET":                  sessionParamNumber,
+	"STATEMENT_QUEUED_TIMEOUT_IN_SECONDS": sessionParamNumber,
+	"STATEMENT_TIMEOUT_IN_SECONDS":        sessionParamNumber,
+	"STRICT_JSON_OUTPUT":                  sessionParamBoolean,
+	"TIME_INPUT_FORMAT":                   sessionParamString,
+	"TIME_OUTPUT_FORMAT":                  sessionParamString,
+	"TIMESTAMP_DAY_IS_ALWAYS_24H":         sessionParamBoolean,
+	"TIMESTAMP_INPUT_FORMAT":              sessionParamString,
+	"TIMESTAMP_LTZ_OUTPUT_FORMAT":         sessionParamString,
+	"TIMESTAMP_NTZ_OUTPUT_FORMAT":         sessionParamString,
+	"TIMESTAMP_OUTPUT_FORMAT":             sessionParamString,
+	"TIMESTAMP_TYPE_MAPPING":              sessionParamString,
+	"TIMESTAMP_TZ_OUTPUT_FORMAT":          sessionParamString,
+	"TIMEZONE":                            sessionParamString,
+	"TRANSACTION_ABORT_ON_ERROR":          sessionParamBoolean,
+	"TRANSACTION_DEFAULT_ISOLATION_LEVEL": sessionParamString,
+	"TWO_DIGIT_CENTURY_START":             sessionParamNumber,
+	"UNSUPPORTED_DDL_ACTION":              sessionParamString,
+	"USE_CACHED_RESULT":                   sessionParamBoolean,
+	"WEEK_OF_YEAR_POLICY":                 sessionParamNumber,
+	"WEEK_START":                          sessionParamNumber,
+}
+
+// alterSessionSQL validates params and renders them as a single ALTER SESSION statement
+func alterSessionSQL(params map[string]string) (string, error) {
+	values := make(map[string]string, len(params))
+	names := make([]string, 0, len(params))
+	for name, value := range params {
+		upper := strings.ToUpper(strings.TrimSpace(name))
+		typ, ok := knownSessionParameters[upper]
+		if !ok {
+			return "", fmt.Errorf("%w: '%s'", ErrUnknownSessionParameter, name)
+		}
+		values[upper] = sessionParamLiteral(value, typ)
+		names = append(names, upper)
+	}
+	sort.Strings(names)
+
+	var sql strings.Builder
+	sql.WriteString("ALTER SESSION SET ")
+	for idx, name := range names {
+		if idx > 0 {
+			sql.WriteString(", ")
+		}
+		sql.WriteString(name)
+		sql.WriteString(" = ")
+		sql.WriteString(values[name])
+	}
+	return sql.String(), nil
+}
+
+// sessionParamLiteral renders value as the literal typ takes, string parameters are always quoted so QUERY_TAG = 2024
+// stays a string. Values not of the parameter's type are quoted and left for Snowflake to reject.
+func sessionParamLiteral(value string, typ sessionParamType) string {
+	switch typ {
+	case sessionParamBoolean:
+		if up := strings.ToUpper(strings.TrimSpace(value)); up == "TRUE" || up == "FALSE" {
+			return up
+		}
+	case sessionParamNumber:
+		if n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil {
+			return strconv.FormatInt(n, 10)
+		}
+	}
+	return stringLiteral(value)
+}
+
+// sessionParamsConnector runs an ALTER SESSION on every physical connection it opens, so each pooled
+// connection starts with the same session parameters regardless of how the pool was built
+type sessionParamsConnector struct {
+	driver.Connector
+	alterSQL string
+}
+
+func (c *sessionParamsConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := execDriverConn(ctx, conn, c.alterSQL); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to apply session parameters: %w", err)
+	}
+	return conn, nil
+}
+
+func execDriverConn(ctx context.Context, conn driver.Conn, query string) error {
+	if execer, ok := conn.(driver.ExecerContext); ok {
+		_, err := execer.ExecContext(ctx, query, nil)
+		return err
+	}
+
+	stmt, err := conn.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(nil)
+	return err
+}
+
+// dsnConnector adapts a registered driver and DSN to driver.Connector for drivers without DriverContext
+type dsnConnector struct {
+	driver driver.Driver
+	dsn    string
+}
+
+func (c *dsnConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c *dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+func openDSNConnector(driverName, dsn string) (driver.Connector, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	drv := db.Driver()
+	_ = db.Close()
+
+	if dc, ok := drv.(driver.DriverContext); ok {
+		return dc.OpenConnector(dsn)
+	}
+	return &dsnConnector{driver: drv, dsn: dsn}, nil
+}
@@ -0,0 +1,134 @@
+package snowflake_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"sync"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+	snowflake "github.com/vonix/gorm-snowflake"
+	"gorm.io/gorm"
+)
+
+// recordingConnector hands out connections that record every statement executed on them
+type recordingConnector struct {
+	mu      sync.Mutex
+	execs   []string
+	connect int
+}
+
+func (c *recordingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	c.mu.Lock()
+	c.connect++
+	c.mu.Unlock()
+	return &recordingConn{connector: c}, nil
+}
+
+func (c *recordingConnector) Driver() driver.Driver {
+	return nil
+}
+
+func (c *recordingConnector) statements() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.execs...)
+}
+
+type recordingConn struct {
+	fakeConn
+	connector *recordingConnector
+}
+
+func (c *recordingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.connector.mu.Lock()
+	c.connector.execs = append(c.connector.execs, query)
+	c.connector.mu.Unlock()
+	return driver.RowsAffected(0), nil
+}
+
+func TestSessionParams_AppliedOnEveryConnection(t *testing.T) {
+	connector := &recordingConnector{}
+
+	db, err := gorm.Open(snowflake.New(snowflake.Config{
+		Connector: connector,
+		SessionParams: map[string]string{
+			"query_tag":                      "billing-service",
+			"TIMEZONE":                       "UTC",
+			"STATEMENT_TIMEOUT_IN_SECONDS":   "60",
+			"QUOTED_IDENTIFIERS_IGNORE_CASE": "false",
+		},
+	}), &gorm.Config{})
+	require.NoError(t, err)
+
+	want := "ALTER SESSION SET QUERY_TAG = 'billing-service', QUOTED_IDENTIFIERS_IGNORE_CASE = FALSE, STATEMENT_TIMEOUT_IN_SECONDS = 60, TIMEZONE = 'UTC'"
+	require.Equal(t, []string{want}, connector.statements())
+
+	// force a second physical connection while the first one is held
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	first, err := sqlDB.Conn(context.Background())
+	require.NoError(t, err)
+	defer first.Close()
+	second, err := sqlDB.Conn(context.Background())
+	require.NoError(t, err)
+	defer second.Close()
+
+	require.Equal(t, []string{want, want}, connector.statements())
+}
+
+func TestSessionParams_EscapesValues(t *testing.T) {
+	connector := &recordingConnector{}
+
+	_, err := gorm.Open(snowflake.New(snowflake.Config{
+		Connector:     connector,
+		SessionParams: map[string]string{"QUERY_TAG": "it's tagged", "TIMESTAMP_OUTPUT_FORMAT": `\'; DROP TABLE USERS --\`},
+	}), &gorm.Config{})
+	require.NoError(t, err)
+	want := `ALTER SESSION SET QUERY_TAG = 'it''s tagged', TIMESTAMP_OUTPUT_FORMAT = '\\''; DROP TABLE USERS --\\'`
+	require.Equal(t, []string{want}, connector.statements())
+}
+
+func TestSessionParams_QuotesByParameterType(t *testing.T) {
+	connector := &recordingConnector{}
+
+	_, err := gorm.Open(snowflake.New(snowflake.Config{
+		Connector: connector,
+		SessionParams: map[string]string{
+			"QUERY_TAG":          "2024",
+			"WEEK_START":         "1",
+			"USE_CACHED_RESULT":  "true",
+			"LOCK_TIMEOUT":       "1; DROP TABLE USERS",
+			"DATE_OUTPUT_FORMAT": "YYYY-MM-DD",
+		},
+	}), &gorm.Config{})
+	require.NoError(t, err)
+
+	want := "ALTER SESSION SET DATE_OUTPUT_FORMAT = 'YYYY-MM-DD', LOCK_TIMEOUT = '1; DROP TABLE USERS', QUERY_TAG = '2024', " +
+		"USE_CACHED_RESULT = TRUE, WEEK_START = 1"
+	require.Equal(t, []string{want}, connector.statements())
+}
+
+func TestSessionParams_UnknownParameter(t *testing.T) {
+	_, err := gorm.Open(snowflake.New(snowflake.Config{
+		Connector:     &recordingConnector{},
+		SessionParams: map[string]string{"QUERY_TAGS": "typo"},
+	}), &gorm.Config{})
+	require.ErrorIs(t, err, snowflake.ErrUnknownSessionParameter)
+
+	_, err = snowflake.OpenWithOptions(snowflake.WithSessionParams(map[string]string{"NOT_A_PARAM": "1"}))
+	require.ErrorIs(t, err, snowflake.ErrUnknownSessionParameter)
+}
+
+func TestSessionParams_RejectedWithConn(t *testing.T) {
+	mockDb, _, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDb.Close()
+
+	_, err = gorm.Open(snowflake.New(snowflake.Config{
+		Conn:          mockDb,
+		SessionParams: map[string]string{"QUERY_TAG": "billing-service"},
+	}), &gorm.Config{})
+	require.ErrorIs(t, err, snowflake.ErrSessionParamsUnsupported)
+}
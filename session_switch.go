@@ -0,0 +1,243 @@
+package snowflake
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSessionSwitchFailed      = errors.New("failed to switch the session warehouse or role")
+	ErrSessionSwitchUnsupported = errors.New("session switch is not supported here")
+)
+
+const sessionSwitchKey = "snowflake:session_switch"
+
+type sessionTargetKey struct{}
+
+type sessionTarget struct {
+	warehouse string
+	role      string
+}
+
+// WithWarehouse returns a context that runs statements on warehouse. The connection is switched with USE WAREHOUSE
+// before the statement and switched back afterwards, so the pool never hands out a connection on the wrong warehouse.
+func WithWarehouse(ctx context.Context, warehouse string) context.Context {
+	target, _ := ctx.Value(sessionTargetKey{}).(sessionTarget)
+	target.warehouse = warehouse
+	return context.WithValue(ctx, sessionTargetKey{}, target)
+}
+
+// WithRole works like WithWarehouse for the session role
+func WithRole(ctx context.Context, role string) context.Context {
+	target, _ := ctx.Value(sessionTargetKey{}).(sessionTarget)
+	target.role = role
+	return context.WithValue(ctx, sessionTargetKey{}, target)
+}
+
+// UseWarehouse is the db.Scopes counterpart of WithWarehouse
+func UseWarehouse(warehouse string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db.Statement.Context = WithWarehouse(db.Statement.Context, warehouse)
+		return db
+	}
+}
+
+// UseRole is the db.Scopes counterpart of WithRole
+func UseRole(role string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db.Statement.Context = WithRole(db.Statement.Context, role)
+		return db
+	}
+}
+
+// sessionSwitch is what switchSession changed, restoreSession undoes it. Outside a transaction the statement
+// runs on conn, a connection pinned from pool for the duration of the statement.
+type sessionSwitch struct {
+	pool gorm.ConnPool
+	conn *sql.Conn
+	rows bool
+
+	warehouse         sql.NullString
+	role              sql.NullString
+	switchedWarehouse bool
+	switchedRole      bool
+}
+
+func registerSessionSwitchCallbacks(db *gorm.DB) {
+	callback := db.Callback()
+	_ = callback.Create().Before("*").Register("snowflake:switch_session", switchSession)
+	_ = callback.Create().After("*").Register("snowflake:restore_session", restoreSession)
+	_ = callback.Query().Before("*").Register("snowflake:switch_session", switchSession)
+	_ = callback.Query().After("*").Register("snowflake:restore_session", restoreSession)
+	_ = callback.Update().Before("*").Register("snowflake:switch_session", switchSession)
+	_ = callback.Update().After("*").Register("snowflake:restore_session", restoreSession)
+	_ = callback.Delete().Before("*").Register("snowflake:switch_session", switchSession)
+	_ = callback.Delete().After("*").Register("snowflake:restore_session", restoreSession)
+	_ = callback.Raw().Before("*").Register("snowflake:switch_session", switchSession)
+	_ = callback.Raw().After("*").Register("snowflake:restore_session", restoreSession)
+	_ = callback.Row().Before("*").Register("snowflake:switch_session", switchRowSession)
+	_ = callback.Row().After("*").Register("snowflake:restore_session", restoreSession)
+}
+
+func switchSession(db *gorm.DB) {
+	beginSessionSwitch(db, false)
+}
+
+// switchRowSession is used for Row and Rows, the returned rows keep the pinned connection busy after the callbacks
+// finished so it is only released once they are closed
+func switchRowSession(db *gorm.DB) {
+	beginSessionSwitch(db, true)
+}
+
+func beginSessionSwitch(db *gorm.DB, rows bool) {
+	if db.Error != nil || db.DryRun {
+		return
+	}
+
+	target, ok := db.Statement.Context.Value(sessionTargetKey{}).(sessionTarget)
+	if !ok || (target.warehouse == "" && target.role == "") {
+		return
+	}
+
+	state := &sessionSwitch{pool: db.Statement.ConnPool, rows: rows}
+	conn := db.Statement.ConnPool
+
+	if pool := pinnablePool(db.Statement.ConnPool); pool != nil {
+		pinned, err := pool.Conn(db.Statement.Context)
+		if err != nil {
+			_ = db.AddError(fmt.Errorf("%w: %w", ErrSessionSwitchFailed, err))
+			return
+		}
+		state.conn = pinned
+		conn = pinned
+		db.Statement.ConnPool = pinned
+	}
+	db.InstanceSet(sessionSwitchKey, state)
+
+	if err := conn.QueryRowContext(db.Statement.Context, "SELECT CURRENT_WAREHOUSE(), CURRENT_ROLE()").Scan(&state.warehouse, &state.role); err != nil {
+		_ = db.AddError(fmt.Errorf("%w: %w", ErrSessionSwitchFailed, err))
+		return
+	}
+
+	// the role goes first, it decides which warehouses may be used
+	if target.role != "" && !sameIdentifier(target.role, state.role) {
+		if err := state.checkRestorable("role", state.role); err != nil {
+			_ = db.AddError(err)
+			return
+		}
+
+		state.switchedRole = true
+		if _, err := conn.ExecContext(db.Statement.Context, "USE ROLE "+quoteIdentifier(target.role)); err != nil {
+			_ = db.AddError(fmt.Errorf("%w: %w", ErrSessionSwitchFailed, err))
+			return
+		}
+	}
+
+	if target.warehouse != "" && !sameIdentifier(target.warehouse, state.warehouse) {
+		if err := state.checkRestorable("warehouse", state.warehouse); err != nil {
+			_ = db.AddError(err)
+			return
+		}
+
+		state.switchedWarehouse = true
+		if _, err := conn.ExecContext(db.Statement.Context, "USE WAREHOUSE "+quoteIdentifier(target.warehouse)); err != nil {
+			_ = db.AddError(fmt.Errorf("%w: %w", ErrSessionSwitchFailed, err))
+		}
+	}
+}
+
+// checkRestorable rejects switching away from an unset warehouse or role inside a transaction, there is no USE
+// statement to get back to it and the connection cannot be discarded
+func (state *sessionSwitch) checkRestorable(kind string, previous sql.NullString) error {
+	if state.conn == nil && !previous.Valid {
+		return fmt.Errorf("%w: the session has no %s to switch back to inside a transaction", ErrSessionSwitchUnsupported, kind)
+	}
+	return nil
+}
+
+func restoreSession(db *gorm.DB) {
+	value, ok := db.InstanceGet(sessionSwitchKey)
+	if !ok {
+		return
+	}
+	state := value.(*sessionSwitch)
+
+	var conn gorm.ConnPool = state.conn
+	if state.conn == nil {
+		conn = state.pool
+	}
+
+	var err error
+	if state.switchedRole {
+		err = restoreIdentifier(db.Statement.Context, conn, "ROLE", state.role)
+	}
+	if err == nil && state.switchedWarehouse {
+		err = restoreIdentifier(db.Statement.Context, conn, "WAREHOUSE", state.warehouse)
+	}
+
+	if state.conn == nil {
+		if err != nil {
+			_ = db.AddError(fmt.Errorf("%w: failed to switch back: %w", ErrSessionSwitchFailed, err))
+		}
+		return
+	}
+
+	db.Statement.ConnPool = state.pool
+
+	if err != nil {
+		log.Warn().Err(err).Msg("discarding connection, failed to restore its warehouse or role")
+	}
+
+	release := func() {
+		if err != nil {
+			// returning ErrBadConn from Raw makes database/sql close the connection instead of pooling it
+			_ = state.conn.Raw(func(any) error { return driver.ErrBadConn })
+			return
+		}
+		_ = state.conn.Close()
+	}
+
+	if state.rows {
+		// closing waits for the rows handed to the caller, do it in the background
+		go release()
+	} else {
+		release()
+	}
+}
+
+func restoreIdentifier(ctx context.Context, conn gorm.ConnPool, kind string, previous sql.NullString) error {
+	if !previous.Valid {
+		return fmt.Errorf("the session had no %s", strings.ToLower(kind))
+	}
+
+	// the CURRENT_* functions return the name as stored, quoting it keeps the exact case
+	_, err := conn.ExecContext(ctx, "USE "+kind+" "+doubleQuote(previous.String))
+	return err
+}
+
+// pinnablePool returns the *sql.DB behind pool when statements would otherwise be spread over pooled connections,
+// nil for transactions and single connections where the session already belongs to the caller
+func pinnablePool(pool gorm.ConnPool) interface {
+	Conn(ctx context.Context) (*sql.Conn, error)
+} {
+	switch p := pool.(type) {
+	case *sql.DB:
+		return p
+	case gorm.GetDBConnector:
+		if sqlDB, err := p.GetDBConn(); err == nil {
+			return sqlDB
+		}
+	}
+	return nil
+}
+
+func sameIdentifier(name string, current sql.NullString) bool {
+	return current.Valid && storedIdentifier(name) == current.String
+}
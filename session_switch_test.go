@@ -0,0 +1,144 @@
+package snowflake_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+	snowflake "github.com/vonix/gorm-snowflake"
+	"gorm.io/gorm"
+)
+
+func expectCurrentSession(mock sqlmock.Sqlmock, warehouse, role interface{}) {
+	mock.ExpectQuery("SELECT CURRENT_WAREHOUSE(), CURRENT_ROLE()").
+		WillReturnRows(sqlmock.NewRows([]string{"warehouse", "role"}).AddRow(warehouse, role))
+}
+
+func TestWithWarehouse_SwitchesAndRestores(t *testing.T) {
+	db, mock := openMock(t, snowflake.Config{}, &gorm.Config{})
+
+	expectCurrentSession(mock, "WH_S", "ANALYST")
+	mock.ExpectExec("USE WAREHOUSE wh_l").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT * FROM USERS").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "a"))
+	mock.ExpectExec(`USE WAREHOUSE "WH_S"`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	var users []User
+	err := db.WithContext(snowflake.WithWarehouse(context.Background(), "wh_l")).Find(&users).Error
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUseRole_SwitchesRoleBeforeWarehouse(t *testing.T) {
+	db, mock := openMock(t, snowflake.Config{}, &gorm.Config{})
+
+	expectCurrentSession(mock, "WH_S", "ANALYST")
+	mock.ExpectExec(`USE ROLE "Loader Role"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("USE WAREHOUSE WH_L").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM USERS WHERE ID = 1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`USE ROLE "ANALYST"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`USE WAREHOUSE "WH_S"`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := db.Scopes(snowflake.UseWarehouse("WH_L"), snowflake.UseRole("Loader Role")).
+		Exec("DELETE FROM USERS WHERE ID = 1").Error
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWithWarehouse_SkipsSwitchWhenAlreadyActive(t *testing.T) {
+	db, mock := openMock(t, snowflake.Config{}, &gorm.Config{})
+
+	expectCurrentSession(mock, "WH_L", "ANALYST")
+	mock.ExpectQuery("SELECT * FROM USERS").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+
+	var users []User
+	err := db.WithContext(snowflake.WithWarehouse(context.Background(), "WH_L")).Find(&users).Error
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWithWarehouse_QuotesReservedKeywords(t *testing.T) {
+	db, mock := openMock(t, snowflake.Config{}, &gorm.Config{})
+
+	expectCurrentSession(mock, "WH_S", "ANALYST")
+	mock.ExpectExec(`USE WAREHOUSE "ORDER"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT * FROM USERS").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+	mock.ExpectExec(`USE WAREHOUSE "WH_S"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	// already on the warehouse the keyword names
+	expectCurrentSession(mock, "ORDER", "ANALYST")
+	mock.ExpectQuery("SELECT * FROM USERS").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+
+	var users []User
+	ctx := snowflake.WithWarehouse(context.Background(), "order")
+	require.NoError(t, db.WithContext(ctx).Find(&users).Error)
+	require.NoError(t, db.WithContext(ctx).Find(&users).Error)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWithWarehouse_CreateSwitchesAroundTransaction(t *testing.T) {
+	db, mock := openMock(t, snowflake.Config{}, &gorm.Config{})
+
+	expectCurrentSession(mock, "WH_S", "ANALYST")
+	mock.ExpectExec("USE WAREHOUSE WH_L").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO USERS (NAME,ID) VALUES (?,?);").WithArgs("a", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec(`USE WAREHOUSE "WH_S"`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := db.WithContext(snowflake.WithWarehouse(context.Background(), "WH_L")).Create(&User{ID: 1, Name: "a"}).Error
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWithWarehouse_DiscardsConnectionWhenRestoreFails(t *testing.T) {
+	db, mock := openMock(t, snowflake.Config{}, &gorm.Config{})
+
+	expectCurrentSession(mock, "WH_S", "ANALYST")
+	mock.ExpectExec("USE WAREHOUSE WH_L").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT * FROM USERS").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+	mock.ExpectExec(`USE WAREHOUSE "WH_S"`).WillReturnError(errors.New("warehouse dropped"))
+
+	var users []User
+	err := db.WithContext(snowflake.WithWarehouse(context.Background(), "WH_L")).Find(&users).Error
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	require.Equal(t, 0, sqlDB.Stats().OpenConnections, "connection on the wrong warehouse must not be pooled")
+}
+
+func TestWithWarehouse_RejectsUnsetWarehouseInTransaction(t *testing.T) {
+	db, mock := openMock(t, snowflake.Config{}, &gorm.Config{})
+
+	mock.ExpectBegin()
+	expectCurrentSession(mock, nil, "ANALYST")
+	mock.ExpectRollback()
+
+	tx := db.Begin()
+	require.NoError(t, tx.Error)
+
+	var users []User
+	err := tx.WithContext(snowflake.WithWarehouse(context.Background(), "WH_L")).Find(&users).Error
+	require.ErrorIs(t, err, snowflake.ErrSessionSwitchUnsupported)
+	require.NoError(t, tx.Rollback().Error)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWithWarehouse_RawScanReleasesConnection(t *testing.T) {
+	db, mock := openMock(t, snowflake.Config{}, &gorm.Config{})
+
+	expectCurrentSession(mock, "WH_S", "ANALYST")
+	mock.ExpectExec("USE WAREHOUSE WH_L").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT COUNT(*) FROM USERS").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectExec(`USE WAREHOUSE "WH_S"`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	var count int64
+	err := db.WithContext(snowflake.WithWarehouse(context.Background(), "WH_L")).
+		Raw("SELECT COUNT(*) FROM USERS").Scan(&count).Error
+	require.NoError(t, err)
+	require.Equal(t, int64(3), count)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
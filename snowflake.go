@@ -8,6 +8,7 @@ import (
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -15,7 +16,6 @@ import (
 	"gorm.io/gorm"
 	"gorm.io/gorm/callbacks"
 	"gorm.io/gorm/clause"
-	"gorm.io/gorm/logger"
 	"gorm.io/gorm/migrator"
 	"gorm.io/gorm/schema"
 )
@@ -38,7 +38,11 @@ var (
 	ErrConnectionFailed = errors.New("failed to establish connection with key-pair authentication")
 
 	ErrMalformedPEMBlock   = errors.New("malformed PEM block: no valid PEM data found")
-	ErrInvalidPEMBlockType = errors.New("invalid PEM block type: expected PRIVATE KEY or RSA PRIVATE KEY")
+	ErrInvalidPEMBlockType = errors.New("invalid PEM block type: expected PRIVATE KEY, RSA PRIVATE KEY or ENCRYPTED PRIVATE KEY")
+
+	ErrMissingPassphrase        = errors.New("missing passphrase: encrypted private key requires a passphrase")
+	ErrIncorrectPassphrase      = errors.New("incorrect passphrase: failed to decrypt private key")
+	ErrUnsupportedKeyEncryption = errors.New("unsupported private key encryption: only PBES2 with PBKDF2 and AES-CBC or 3DES-CBC is supported")
 )
 
 type Dialector struct {
@@ -51,6 +55,29 @@ type Config struct {
 	Conn       gorm.ConnPool
 	Connector  driver.Connector //connector support for key-pair auth
 
+	// SessionParams are applied to every physical connection, e.g. QUERY_TAG or TIMEZONE
+	SessionParams map[string]string
+	// Retry retries idempotent statements failing with transient errors, nil disables retries
+	Retry *RetryPolicy
+	// FetchFirst renders limits as OFFSET m ROWS FETCH FIRST n ROWS ONLY instead of LIMIT n OFFSET m
+	FetchFirst bool
+	// OrderPagesByPrimaryKey adds ORDER BY on the primary key to limited queries without an order, so pages are stable
+	OrderPagesByPrimaryKey bool
+	// CaseSensitiveIdentifiers double-quotes every identifier and keeps its case instead of uppercasing it
+	CaseSensitiveIdentifiers bool
+	// RollbackOnlyNestedTransactions runs nested transactions inside the outer one, a failing nested transaction
+	// makes the outer one roll back on commit. By default nested transactions fail with ErrNestedTransaction.
+	RollbackOnlyNestedTransactions bool
+	// Returning writes values generated by the database back to the structs after Create, see ReturningMode
+	Returning ReturningMode
+	// MaxBindVars and MaxStatementSize, in bytes, split a multi-row Create into several statements that stay below
+	// them, zero uses 16384 variables and 1 MiB
+	MaxBindVars      int
+	MaxStatementSize int
+	// ArrayBindThreshold inserts slices of at least this many rows with one gosnowflake.Array bind per column
+	// instead of a VALUES list, zero disables array binding
+	ArrayBindThreshold int
+
 	// For testing purposes
 	CreateTableFunc   func(values ...interface{}) error
 	HasTableFunc      func(value interface{}) bool
@@ -59,6 +86,19 @@ type Config struct {
 	MigrateColumnFunc func(value interface{}, field *schema.Field, columnType gorm.ColumnType) error
 }
 
+// configOf returns the Config of the dialector db was opened with, nil for dialectors of other packages
+func configOf(db *gorm.DB) *Config {
+	switch dialector := db.Dialector.(type) {
+	case *Dialector:
+		return dialector.Config
+	case Dialector:
+		return dialector.Config
+	case *OfflineDialector:
+		return dialector.Config
+	}
+	return nil
+}
+
 func (dialector Dialector) Name() string {
 	return SnowflakeDriverName
 }
@@ -77,11 +117,17 @@ func New(config Config) gorm.Dialector {
 }
 
 func OpenWithKey(account, user, privateKeyPEM, database, schema, warehouse, role string) (gorm.Dialector, error) {
+	return OpenWithEncryptedKey(account, user, privateKeyPEM, "", database, schema, warehouse, role)
+}
+
+// OpenWithEncryptedKey works like OpenWithKey but also accepts an ENCRYPTED PRIVATE KEY
+// PEM block, which is decrypted with passphrase before validation
+func OpenWithEncryptedKey(account, user, privateKeyPEM, passphrase, database, schema, warehouse, role string) (gorm.Dialector, error) {
 	if err := validateConnectionParameters(account, user, privateKeyPEM, database); err != nil {
 		return nil, err
 	}
 
-	privateKey, err := parsePEMPrivateKey(privateKeyPEM)
+	privateKey, err := parsePEMPrivateKeyWithPassphrase(privateKeyPEM, passphrase)
 	if err != nil {
 		return nil, err
 	}
@@ -108,38 +154,40 @@ func OpenWithKey(account, user, privateKeyPEM, database, schema, warehouse, role
 }
 
 func validateConnectionParameters(account, user, privateKeyPEM, database string) error {
-	if account == "" {
-		return fmt.Errorf("%w: account is required", ErrInvalidAccount)
-	}
-	if strings.TrimSpace(account) == "" {
-		return fmt.Errorf("%w: account cannot be only whitespace", ErrInvalidAccount)
+	if err := validateRequired(account, "account", ErrInvalidAccount); err != nil {
+		return err
 	}
 
-	if user == "" {
-		return fmt.Errorf("%w: user is required", ErrInvalidUser)
-	}
-	if strings.TrimSpace(user) == "" {
-		return fmt.Errorf("%w: user cannot be only whitespace", ErrInvalidUser)
+	if err := validateRequired(user, "user", ErrInvalidUser); err != nil {
+		return err
 	}
 
-	if privateKeyPEM == "" {
-		return fmt.Errorf("%w: privateKeyPEM is required", ErrEmptyPrivateKey)
+	if err := validateRequired(privateKeyPEM, "privateKeyPEM", ErrEmptyPrivateKey); err != nil {
+		return err
 	}
-	if strings.TrimSpace(privateKeyPEM) == "" {
-		return fmt.Errorf("%w: privateKeyPEM cannot be only whitespace", ErrEmptyPrivateKey)
+
+	if err := validateRequired(database, "database", ErrInvalidDatabase); err != nil {
+		return err
 	}
 
-	if database == "" {
-		return fmt.Errorf("%w: database is required", ErrInvalidDatabase)
+	return nil
+}
+
+func validateRequired(value, name string, sentinel error) error {
+	if value == "" {
+		return fmt.Errorf("%w: %s is required", sentinel, name)
 	}
-	if strings.TrimSpace(database) == "" {
-		return fmt.Errorf("%w: database cannot be only whitespace", ErrInvalidDatabase)
+	if strings.TrimSpace(value) == "" {
+		return fmt.Errorf("%w: %s cannot be only whitespace", sentinel, name)
 	}
-
 	return nil
 }
 
 func parsePEMPrivateKey(privateKeyPEM string) (*rsa.PrivateKey, error) {
+	return parsePEMPrivateKeyWithPassphrase(privateKeyPEM, "")
+}
+
+func parsePEMPrivateKeyWithPassphrase(privateKeyPEM, passphrase string) (*rsa.PrivateKey, error) {
 	trimmedPEM := strings.TrimSpace(privateKeyPEM)
 	if trimmedPEM == "" {
 		return nil, fmt.Errorf("%w: private key string is empty after trimming whitespace", ErrEmptyPrivateKey)
@@ -154,14 +202,26 @@ func parsePEMPrivateKey(privateKeyPEM string) (*rsa.PrivateKey, error) {
 		return nil, fmt.Errorf("%w: no valid PEM block found in input", ErrMalformedPEMBlock)
 	}
 
-	if block.Type != "PRIVATE KEY" && block.Type != "RSA PRIVATE KEY" {
-		return nil, fmt.Errorf("%w: expected 'PRIVATE KEY' or 'RSA PRIVATE KEY', got '%s'", ErrInvalidPEMBlockType, block.Type)
+	if block.Type != "PRIVATE KEY" && block.Type != "RSA PRIVATE KEY" && block.Type != "ENCRYPTED PRIVATE KEY" {
+		return nil, fmt.Errorf("%w: expected 'PRIVATE KEY', 'RSA PRIVATE KEY' or 'ENCRYPTED PRIVATE KEY', got '%s'", ErrInvalidPEMBlockType, block.Type)
 	}
 
 	if len(block.Bytes) == 0 {
 		return nil, fmt.Errorf("%w: PEM block contains no data", ErrMalformedPEMBlock)
 	}
 
+	if block.Type == "ENCRYPTED PRIVATE KEY" {
+		if passphrase == "" {
+			return nil, fmt.Errorf("%w: got 'ENCRYPTED PRIVATE KEY' without a passphrase", ErrMissingPassphrase)
+		}
+
+		decrypted, err := decryptPKCS8PrivateKey(block.Bytes, []byte(passphrase))
+		if err != nil {
+			return nil, err
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: decrypted}
+	}
+
 	var privateKey *rsa.PrivateKey
 	var err error
 
@@ -190,22 +250,44 @@ func parsePEMPrivateKey(privateKeyPEM string) (*rsa.PrivateKey, error) {
 		}
 	}
 
+	if err := validatePrivateKey(privateKey); err != nil {
+		return nil, err
+	}
+
+	return privateKey, nil
+}
+
+func validatePrivateKey(privateKey *rsa.PrivateKey) error {
+	if privateKey == nil {
+		return fmt.Errorf("%w: private key is nil", ErrEmptyPrivateKey)
+	}
+
 	if err := privateKey.Validate(); err != nil {
-		return nil, fmt.Errorf("%w: RSA key structure validation failed: %v", ErrKeyValidationFailed, err)
+		return fmt.Errorf("%w: RSA key structure validation failed: %v", ErrKeyValidationFailed, err)
 	}
 
 	keySize := privateKey.N.BitLen()
 	if keySize < 2048 {
-		return nil, fmt.Errorf("%w: RSA key size %d bits is too small, minimum 2048 bits required", ErrKeyValidationFailed, keySize)
+		return fmt.Errorf("%w: RSA key size %d bits is too small, minimum 2048 bits required", ErrKeyValidationFailed, keySize)
 	}
 
-	return privateKey, nil
+	return nil
 }
 
 func (dialector Dialector) Initialize(db *gorm.DB) error {
 	db.Config.NamingStrategy = NewNamingStrategy()
 	callbacks.RegisterDefaultCallbacks(db, &callbacks.Config{})
 	_ = db.Callback().Create().Replace("gorm:create", Create)
+	registerSessionSwitchCallbacks(db)
+	if dialector.Returning != ReturningNone {
+		if err := registerReturningCallbacks(db, dialector.Returning); err != nil {
+			return err
+		}
+	}
+
+	for name, builder := range dialector.ClauseBuilders() {
+		db.ClauseBuilders[name] = builder
+	}
 
 	dialector.DriverName = SnowflakeDriverName
 
@@ -214,15 +296,32 @@ func (dialector Dialector) Initialize(db *gorm.DB) error {
 		return err
 	}
 
+	if dialector.Retry != nil {
+		if connPool, err = newRetryConnPool(connPool, *dialector.Retry); err != nil {
+			return err
+		}
+	}
+
+	if dialector.RollbackOnlyNestedTransactions {
+		connPool = &nestedTxConnPool{ConnPool: connPool}
+	}
+
 	db.ConnPool = connPool
 	return nil
 }
 
 func (dialector Dialector) createConnectionPool() (gorm.ConnPool, error) {
 	if dialector.Conn != nil {
+		if len(dialector.SessionParams) > 0 {
+			return nil, ErrSessionParamsUnsupported
+		}
 		return dialector.Conn, nil
 	}
 
+	if len(dialector.SessionParams) > 0 {
+		return dialector.createSessionParamsPool()
+	}
+
 	if dialector.Connector != nil {
 		connPool := sql.OpenDB(dialector.Connector)
 		if connPool == nil {
@@ -242,68 +341,185 @@ func (dialector Dialector) createConnectionPool() (gorm.ConnPool, error) {
 	return nil, errors.New("no connection information provided: must specify either Conn, Connector, or DSN")
 }
 
-// func (dialector Dialector) ClauseBuilders() map[string]clause.ClauseBuilder {
-// 	return map[string]clause.ClauseBuilder{
-// 		"LIMIT": func(c clause.Clause, builder clause.Builder) {
-// 			if limit, ok := c.Expression.(clause.Limit); ok {
-// 				if stmt, ok := builder.(*gorm.Statement); ok {
-// 					if _, ok := stmt.Clauses["ORDER BY"]; !ok {
-// 						if stmt.Schema != nil && stmt.Schema.PrioritizedPrimaryField != nil {
-// 							builder.WriteString("ORDER BY ")
-// 							builder.WriteQuoted(stmt.Schema.PrioritizedPrimaryField.DBName)
-// 							builder.WriteByte(' ')
-// 						} else {
-// 							builder.WriteString("ORDER BY (SELECT NULL) ")
-// 						}
-// 					}
-// 				}
-
-// 				if limit.Offset > 0 {
-// 					builder.WriteString("OFFSET ")
-// 					builder.WriteString(strconv.Itoa(limit.Offset))
-// 					builder.WriteString(" ROWS")
-// 				}
-
-// 				if limit.Limit != nil && *limit.Limit > 0 {
-// 					if limit.Offset == 0 {
-// 						builder.WriteString("OFFSET 0 ROW")
-// 					}
-// 					builder.WriteString(" FETCH NEXT ")
-// 					builder.WriteString(strconv.Itoa(*limit.Limit))
-// 					builder.WriteString(" ROWS ONLY")
-// 				}
-// 			}
-// 		},
-// 	}
-// }
+func (dialector Dialector) createSessionParamsPool() (gorm.ConnPool, error) {
+	alterSQL, err := alterSessionSQL(dialector.SessionParams)
+	if err != nil {
+		return nil, err
+	}
+
+	connector := dialector.Connector
+	if connector == nil {
+		if dialector.DSN == "" {
+			return nil, errors.New("no connection information provided: must specify either Conn, Connector, or DSN")
+		}
+
+		if connector, err = openDSNConnector(dialector.DriverName, dialector.DSN); err != nil {
+			return nil, fmt.Errorf("failed to open DSN connection: %w", err)
+		}
+	}
+
+	return sql.OpenDB(&sessionParamsConnector{Connector: connector, alterSQL: alterSQL}), nil
+}
+
+func (dialector Dialector) ClauseBuilders() map[string]clause.ClauseBuilder {
+	return map[string]clause.ClauseBuilder{
+		"LIMIT": dialector.buildLimit,
+	}
+}
+
+// buildLimit renders LIMIT n OFFSET m, or OFFSET m ROWS FETCH FIRST n ROWS ONLY with Config.FetchFirst. Snowflake
+// needs a row count before an offset, NULL means all rows.
+func (dialector Dialector) buildLimit(c clause.Clause, builder clause.Builder) {
+	limit, ok := c.Expression.(clause.Limit)
+	if !ok {
+		c.Build(builder)
+		return
+	}
+
+	hasLimit := limit.Limit != nil && *limit.Limit >= 0
+	if !hasLimit && limit.Offset <= 0 {
+		return
+	}
+
+	if dialector.OrderPagesByPrimaryKey {
+		if stmt, ok := builder.(*gorm.Statement); ok {
+			writeDefaultPageOrder(stmt)
+		}
+	}
+
+	count := "NULL"
+	if hasLimit {
+		count = strconv.Itoa(*limit.Limit)
+	}
+
+	if dialector.FetchFirst {
+		if limit.Offset > 0 {
+			builder.WriteString("OFFSET ")
+			builder.WriteString(strconv.Itoa(limit.Offset))
+			builder.WriteString(" ROWS ")
+		}
+		builder.WriteString("FETCH FIRST ")
+		builder.WriteString(count)
+		builder.WriteString(" ROWS ONLY")
+		return
+	}
+
+	builder.WriteString("LIMIT ")
+	builder.WriteString(count)
+	if limit.Offset > 0 {
+		builder.WriteString(" OFFSET ")
+		builder.WriteString(strconv.Itoa(limit.Offset))
+	}
+}
+
+// writeDefaultPageOrder orders by the primary key when a page is requested without ORDER BY, otherwise Snowflake may
+// return rows in a different order for every page. Grouped and distinct queries can't be ordered by it and are left alone.
+func writeDefaultPageOrder(stmt *gorm.Statement) {
+	if _, ok := stmt.Clauses["ORDER BY"]; ok {
+		return
+	}
+	if _, ok := stmt.Clauses["GROUP BY"]; ok || stmt.Distinct {
+		return
+	}
+	if stmt.Schema == nil || stmt.Schema.PrioritizedPrimaryField == nil {
+		return
+	}
+
+	stmt.WriteString("ORDER BY ")
+	stmt.WriteQuoted(clause.Column{Table: clause.CurrentTable, Name: stmt.Schema.PrioritizedPrimaryField.DBName})
+	stmt.WriteByte(' ')
+}
 
 func (d Dialector) DefaultValueOf(field *schema.Field) clause.Expression {
 	if field.AutoIncrement {
 		return clause.Expr{SQL: "GENERATED BY DEFAULT AS IDENTITY"}
 	}
 
-	if field.DefaultValue == "" {
+	switch strings.ToUpper(strings.TrimSpace(field.DefaultValue)) {
+	case "", "(-)":
 		return clause.Expr{SQL: "NULL"}
+	case "IDENTITY":
+		return clause.Expr{SQL: "GENERATED BY DEFAULT AS IDENTITY"}
 	}
 
-	up := strings.ToUpper(field.DefaultValue)
+	return clause.Expr{SQL: defaultValueSQL(field.DefaultValue, d.DataTypeOf(field))}
+}
 
-	switch up {
-	case "CURRENT_TIMESTAMP":
-		return clause.Expr{SQL: "CURRENT_TIMESTAMP"}
-	case "IDENTITY":
-		return clause.Expr{SQL: "GENERATED BY DEFAULT AS IDENTITY"}
-	default:
-		if up == "TRUE" || up == "FALSE" {
-			return clause.Expr{SQL: up}
+var (
+	// defaultFunction matches the context functions Snowflake evaluates for a column default
+	defaultFunction = regexp.MustCompile(`(?i)^(CURRENT_(TIMESTAMP|DATE|TIME|USER|ROLE|DATABASE|SCHEMA)|LOCALTIMESTAMP|LOCALTIME)(\(\d*\))?$|^(SYSDATE|GETDATE|UUID_STRING)\(\)$`)
+	// sequenceNextval matches [database.][schema.]sequence.NEXTVAL
+	sequenceNextval = regexp.MustCompile(`(?i)^(([A-Za-z_][A-Za-z0-9_$]*|"([^"]|"")+")\.){1,3}NEXTVAL$`)
+)
+
+// defaultValueSQL renders the default tag value for a column of dataType. Values in parentheses are used as raw
+// expressions, known functions and sequences as they are, anything else becomes a literal of the column's type.
+func defaultValueSQL(value, dataType string) string {
+	value = strings.TrimSpace(value)
+
+	switch {
+	case len(value) > 1 && value[0] == '(' && value[len(value)-1] == ')':
+		if enclosedInParens(value) {
+			return strings.TrimSpace(value[1 : len(value)-1])
 		}
+		// (a) + (b), an expression as a whole
+		return value
+	case strings.EqualFold(value, "NULL"):
+		return "NULL"
+	case defaultFunction.MatchString(value):
+		return strings.ToUpper(value)
+	case sequenceNextval.MatchString(value):
+		return value
+	}
+
+	if len(value) > 1 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		value = strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+	}
+
+	baseType := strings.ToUpper(strings.TrimSpace(dataType))
+	if i := strings.IndexAny(baseType, "( "); i >= 0 {
+		baseType = baseType[:i]
+	}
 
-		if _, err := strconv.ParseFloat(field.DefaultValue, 64); err == nil {
-			return clause.Expr{SQL: field.DefaultValue}
+	switch baseType {
+	case "BOOLEAN":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return strings.ToUpper(strconv.FormatBool(b))
 		}
+	case "BIGINT", "INT", "INTEGER", "SMALLINT", "TINYINT", "BYTEINT", "NUMBER", "NUMERIC", "DECIMAL",
+		"FLOAT", "FLOAT4", "FLOAT8", "DOUBLE", "REAL":
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			return value
+		}
+	case "DATE", "TIME", "DATETIME", "TIMESTAMP", "TIMESTAMP_NTZ", "TIMESTAMP_LTZ", "TIMESTAMP_TZ":
+		return stringLiteral(value) + "::" + baseType
+	case "VARIANT":
+		return jsonLiteral([]byte(value))
+	case "OBJECT", "ARRAY":
+		return jsonLiteral([]byte(value)) + "::" + baseType
+	}
 
-		return clause.Expr{SQL: fmt.Sprintf("'%s'", field.DefaultValue)}
+	return stringLiteral(value)
+}
+
+// enclosedInParens reports whether the parenthesis opening value is closed by its last byte, parentheses inside
+// string literals and quoted identifiers don't count
+func enclosedInParens(value string) bool {
+	depth := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\'', '"':
+			i = skipQuoted(value, i, value[i]) - 1
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i == len(value)-1
+			}
+		}
 	}
+	return false
 }
 
 func (dialector Dialector) Migrator(db *gorm.DB) gorm.Migrator {
@@ -324,12 +540,125 @@ func (dialector Dialector) BindVarTo(writer clause.Writer, stmt *gorm.Statement,
 	writer.WriteByte('?')
 }
 
+// QuoteTo writes each dot separated part of str as an identifier. By default valid unquoted names are uppercased
+// and anything else is double-quoted, with CaseSensitiveIdentifiers every part is double-quoted as is. Parts that
+// are already quoted are written unchanged.
 func (dialector Dialector) QuoteTo(writer clause.Writer, str string) {
-	writer.WriteString(strings.ToUpper(str))
+	for idx, part := range splitIdentifier(str) {
+		if idx > 0 {
+			writer.WriteByte('.')
+		}
+		writer.WriteString(dialector.quoteIdentifierPart(part))
+	}
+}
+
+func (dialector Dialector) quoteIdentifierPart(part string) string {
+	switch {
+	case part == "*" || isQuotedIdentifier(part):
+		return part
+	case dialector.CaseSensitiveIdentifiers:
+		return doubleQuote(part)
+	case unquotedIdentifier.MatchString(part) && !isReservedKeyword(part):
+		return strings.ToUpper(part)
+	default:
+		return doubleQuote(strings.ToUpper(part))
+	}
+}
+
+// identifierValue returns name the way Snowflake stores it, as INFORMATION_SCHEMA reports it
+func (dialector Dialector) identifierValue(name string) string {
+	parts := splitIdentifier(name)
+	return unquoteIdentifier(dialector.quoteIdentifierPart(parts[len(parts)-1]))
+}
+
+var unquotedIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*$`)
+
+// reservedKeywords are Snowflake's reserved keywords, which can only be used as identifiers when quoted
+var reservedKeywords = map[string]struct{}{
+	"ACCOUNT": {}, "ALL": {}, "ALTER": {}, "AND": {}, "ANY": {}, "AS": {}, "BETWEEN": {}, "BY": {}, "CASE": {},
+	"CAST": {}, "CHECK": {}, "COLUMN": {}, "CONNECT": {}, "CONNECTION": {}, "CONSTRAINT": {}, "CREATE": {},
+	"CROSS": {}, "CURRENT": {}, "CURRENT_DATE": {}, "CURRENT_TIME": {}, "CURRENT_TIMESTAMP": {}, "CURRENT_USER": {},
+	"DATABASE": {}, "DELETE": {}, "DISTINCT": {}, "DROP": {}, "ELSE": {}, "EXISTS": {}, "FALSE": {}, "FOLLOWING": {},
+	"FOR": {}, "FROM": {}, "FULL": {}, "GRANT": {}, "GROUP": {}, "GSCLUSTER": {}, "HAVING": {}, "ILIKE": {}, "IN": {},
+	"INCREMENT": {}, "INNER": {}, "INSERT": {}, "INTERSECT": {}, "INTO": {}, "IS": {}, "ISSUE": {}, "JOIN": {},
+	"LATERAL": {}, "LEFT": {}, "LIKE": {}, "LOCALTIME": {}, "LOCALTIMESTAMP": {}, "MINUS": {}, "NATURAL": {},
+	"NOT": {}, "NULL": {}, "OF": {}, "ON": {}, "OR": {}, "ORDER": {}, "ORGANIZATION": {}, "QUALIFY": {}, "REGEXP": {},
+	"REVOKE": {}, "RIGHT": {}, "RLIKE": {}, "ROW": {}, "ROWS": {}, "SAMPLE": {}, "SCHEMA": {}, "SELECT": {},
+	"SET": {}, "SOME": {}, "START": {}, "TABLE": {}, "TABLESAMPLE": {}, "THEN": {}, "TO": {}, "TRIGGER": {},
+	"TRUE": {}, "TRY_CAST": {}, "UNION": {}, "UNIQUE": {}, "UPDATE": {}, "USING": {}, "VALUES": {}, "VIEW": {},
+	"WHEN": {}, "WHENEVER": {}, "WHERE": {}, "WITH": {},
+}
+
+func isReservedKeyword(part string) bool {
+	_, ok := reservedKeywords[strings.ToUpper(part)]
+	return ok
+}
+
+// quoteIdentifier leaves valid unquoted identifiers as they are and double-quotes anything else,
+// escaping embedded quotes, so a name can never break out of the statement
+func quoteIdentifier(name string) string {
+	if unquotedIdentifier.MatchString(name) && !isReservedKeyword(name) {
+		return name
+	}
+	return doubleQuote(storedIdentifier(name))
+}
+
+// storedIdentifier returns the name Snowflake stores for name written by quoteIdentifier, reserved keywords are
+// quoted uppercased like the other unquoted names
+func storedIdentifier(name string) string {
+	if unquotedIdentifier.MatchString(name) {
+		return strings.ToUpper(name)
+	}
+	return name
+}
+
+func doubleQuote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func isQuotedIdentifier(part string) bool {
+	return len(part) >= 2 && part[0] == '"' && part[len(part)-1] == '"' &&
+		!strings.Contains(strings.ReplaceAll(part[1:len(part)-1], `""`, ""), `"`)
 }
 
-func (dialector Dialector) Explain(sql string, vars ...interface{}) string {
-	return logger.ExplainSQL(sql, nil, `'`, vars...)
+func unquoteIdentifier(part string) string {
+	if !isQuotedIdentifier(part) {
+		return part
+	}
+	return strings.ReplaceAll(part[1:len(part)-1], `""`, `"`)
+}
+
+// statementTable is the full name of the statement's table, gorm moves a schema.table name into TableExpr and keeps
+// only the table in stmt.Table
+func statementTable(stmt *gorm.Statement) string {
+	if expr := stmt.TableExpr; expr != nil && len(expr.Vars) == 0 {
+		parts := splitIdentifier(expr.SQL)
+		if strings.EqualFold(unquoteIdentifier(parts[len(parts)-1]), stmt.Table) {
+			return expr.SQL
+		}
+	}
+	return stmt.Table
+}
+
+// splitIdentifier splits a dotted name into its parts, dots inside double quotes don't split
+func splitIdentifier(name string) []string {
+	var (
+		parts  []string
+		start  int
+		quoted bool
+	)
+	for idx := 0; idx < len(name); idx++ {
+		switch name[idx] {
+		case '"':
+			quoted = !quoted
+		case '.':
+			if !quoted {
+				parts = append(parts, name[start:idx])
+				start = idx + 1
+			}
+		}
+	}
+	return append(parts, name[start:])
 }
 
 func (dialector Dialector) DataTypeOf(field *schema.Field) string {
@@ -338,6 +667,10 @@ func (dialector Dialector) DataTypeOf(field *schema.Field) string {
 		return "BOOLEAN"
 	case schema.Int, schema.Uint:
 		if field.AutoIncrement {
+			if dialector.Config != nil && dialector.Returning == ReturningChanges {
+				// read back rows are lined up by their identity, it has to follow the insert order
+				return "BIGINT IDENTITY(1,1) ORDER"
+			}
 			return "BIGINT IDENTITY(1,1)"
 		}
 		return "BIGINT"
@@ -361,13 +694,3 @@ func (dialector Dialector) DataTypeOf(field *schema.Field) string {
 
 	return string(field.DataType)
 }
-
-// no support for savepoint
-func (dialectopr Dialector) SavePoint(tx *gorm.DB, name string) error {
-	return nil
-}
-
-func (dialectopr Dialector) RollbackTo(tx *gorm.DB, name string) error {
-	tx.Exec("ROLLBACK TRANSACTION " + name)
-	return nil
-}
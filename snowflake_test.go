@@ -1,14 +1,24 @@
 package snowflake_test
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
+	"errors"
 	"strings"
 	"testing"
 
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
 	snowflake "github.com/vonix/gorm-snowflake"
+	"golang.org/x/crypto/pbkdf2"
+	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 	"gorm.io/gorm/schema"
 )
@@ -22,6 +32,26 @@ func getExprSQL(t *testing.T, expr clause.Expression) (sql string, vars []any) {
 	return e.SQL, e.Vars
 }
 
+// openMock opens a Dialector on a sqlmock connection that matches statements exactly
+func openMock(t *testing.T, config snowflake.Config, gormConfig *gorm.Config) (*gorm.DB, sqlmock.Sqlmock) {
+	t.Helper()
+
+	return openMatchingMock(t, config, gormConfig, sqlmock.QueryMatcherEqual)
+}
+
+func openMatchingMock(t *testing.T, config snowflake.Config, gormConfig *gorm.Config, matcher sqlmock.QueryMatcher) (*gorm.DB, sqlmock.Sqlmock) {
+	t.Helper()
+
+	mockDb, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(matcher))
+	require.NoError(t, err)
+	t.Cleanup(func() { mockDb.Close() })
+
+	config.Conn = mockDb
+	db, err := gorm.Open(snowflake.New(config), gormConfig)
+	require.NoError(t, err)
+	return db, mock
+}
+
 func TestDefaultValueOf_AutoIncrementFalse(t *testing.T) {
 	d := snowflake.Dialector{}
 
@@ -92,6 +122,51 @@ func TestDefaultValueOf_BooleanTrue(t *testing.T) {
 		t.Errorf("expected %s, got %s", want, sql)
 	}
 }
+
+func TestDefaultValueOf_Expressions(t *testing.T) {
+	d := snowflake.Dialector{}
+
+	tests := []struct {
+		name     string
+		dataType schema.DataType
+		value    string
+		want     string
+	}{
+		{"quote in literal", schema.String, "it's", "'it''s'"},
+		{"backslash in literal", schema.String, `a\b`, `'a\\b'`},
+		{"quoted literal", "VARCHAR", "'it''s'", "'it''s'"},
+		{"uuid", schema.String, "uuid_string()", "UUID_STRING()"},
+		{"current date", schema.Time, "current_date", "CURRENT_DATE"},
+		{"current user", schema.String, "CURRENT_USER", "CURRENT_USER"},
+		{"sysdate", schema.Time, "SYSDATE()", "SYSDATE()"},
+		{"timestamp precision", schema.Time, "CURRENT_TIMESTAMP(3)", "CURRENT_TIMESTAMP(3)"},
+		{"sequence", schema.Int, "order_seq.nextval", "order_seq.nextval"},
+		{"qualified sequence", schema.Int, `analytics."Raw".order_seq.NEXTVAL`, `analytics."Raw".order_seq.NEXTVAL`},
+		{"raw expression", schema.String, "(CONCAT('a', 'b'))", "CONCAT('a', 'b')"},
+		{"parenthesized operands", schema.Int, "(a) + (b)", "(a) + (b)"},
+		{"parenthesis in literal", schema.String, "(CONCAT(')', '('))", "CONCAT(')', '(')"},
+		{"null", schema.String, "null", "NULL"},
+		{"boolean", schema.Bool, "false", "FALSE"},
+		{"number", schema.Float, "1.5", "1.5"},
+		{"timestamp", schema.Time, "2024-01-01 00:00:00", "'2024-01-01 00:00:00'::TIMESTAMP_NTZ"},
+		{"date", "DATE", "2024-01-01", "'2024-01-01'::DATE"},
+		{"variant", "VARIANT", `{"tier":"gold"}`, `PARSE_JSON('{"tier":"gold"}')`},
+		{"object", "OBJECT", "{}", "PARSE_JSON('{}')::OBJECT"},
+		{"not a number", schema.Int, "1; DROP TABLE USERS", "'1; DROP TABLE USERS'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			field := &schema.Field{DBName: "COL", DataType: tt.dataType, HasDefaultValue: true, DefaultValue: tt.value}
+
+			sql, _ := getExprSQL(t, d.DefaultValueOf(field))
+			if sql != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, sql)
+			}
+		})
+	}
+}
+
 func TestOpenWithKey_ValidKey(t *testing.T) {
 	validPEMKey := generateTestRSAKey(t)
 
@@ -295,7 +370,7 @@ func TestOpenWithKey_MalformedPEMKeys(t *testing.T) {
 		{
 			name:        "wrong PEM block type",
 			privateKey:  "-----BEGIN CERTIFICATE-----\nMIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA\n-----END CERTIFICATE-----",
-			expectedErr: "expected 'PRIVATE KEY' or 'RSA PRIVATE KEY', got 'CERTIFICATE'",
+			expectedErr: "expected 'PRIVATE KEY', 'RSA PRIVATE KEY' or 'ENCRYPTED PRIVATE KEY', got 'CERTIFICATE'",
 		},
 		{
 			name:        "empty PEM block",
@@ -379,3 +454,308 @@ func generateTestRSAKey(t *testing.T) string {
 
 	return string(privateKeyPEM)
 }
+
+func TestOpenWithEncryptedKey_ValidPassphrase(t *testing.T) {
+	encryptedPEM := generateEncryptedTestRSAKey(t, "correct horse", asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}, 32)
+
+	dialector, err := snowflake.OpenWithEncryptedKey(
+		"test-account",
+		"test-user",
+		encryptedPEM,
+		"correct horse",
+		"test-database",
+		"test-schema",
+		"test-warehouse",
+		"test-role",
+	)
+
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if dialector == nil {
+		t.Fatal("expected dialector to be non-nil")
+	}
+}
+
+func TestOpenWithEncryptedKey_Errors(t *testing.T) {
+	aes256 := generateEncryptedTestRSAKey(t, "correct horse", asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}, 32)
+	// AES-256-GCM is a real cipher OID but not one of the supported CBC modes
+	unsupported := generateEncryptedTestRSAKey(t, "correct horse", asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 46}, 32)
+
+	testCases := []struct {
+		name        string
+		privateKey  string
+		passphrase  string
+		expectedErr error
+	}{
+		{
+			name:        "wrong passphrase",
+			privateKey:  aes256,
+			passphrase:  "battery staple",
+			expectedErr: snowflake.ErrIncorrectPassphrase,
+		},
+		{
+			name:        "missing passphrase",
+			privateKey:  aes256,
+			passphrase:  "",
+			expectedErr: snowflake.ErrMissingPassphrase,
+		},
+		{
+			name:        "unsupported cipher",
+			privateKey:  unsupported,
+			passphrase:  "correct horse",
+			expectedErr: snowflake.ErrUnsupportedKeyEncryption,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := snowflake.OpenWithEncryptedKey(
+				"test-account",
+				"test-user",
+				tc.privateKey,
+				tc.passphrase,
+				"test-database",
+				"test-schema",
+				"test-warehouse",
+				"test-role",
+			)
+
+			if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("expected error %v, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestOpenWithKey_EncryptedKeyRequiresPassphrase(t *testing.T) {
+	encryptedPEM := generateEncryptedTestRSAKey(t, "correct horse", asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}, 16)
+
+	_, err := snowflake.OpenWithKey(
+		"test-account",
+		"test-user",
+		encryptedPEM,
+		"test-database",
+		"test-schema",
+		"test-warehouse",
+		"test-role",
+	)
+
+	if !errors.Is(err, snowflake.ErrMissingPassphrase) {
+		t.Errorf("expected ErrMissingPassphrase, got %v", err)
+	}
+}
+
+// generateEncryptedTestRSAKey encrypts a fresh 2048 bit key as PBES2/PBKDF2-SHA256 with the given CBC cipher,
+// the same layout `openssl pkcs8 -topk8 -v2 aes-256-cbc` produces
+func generateEncryptedTestRSAKey(t *testing.T, passphrase string, cipherOID asn1.ObjectIdentifier, keyLen int) string {
+	t.Helper()
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("failed to marshal PKCS#8 key: %v", err)
+	}
+
+	salt := make([]byte, 16)
+	iv := make([]byte, aes.BlockSize)
+	_, _ = rand.Read(salt)
+	_, _ = rand.Read(iv)
+
+	block, err := aes.NewCipher(pbkdf2.Key([]byte(passphrase), salt, 2048, keyLen, sha256.New))
+	if err != nil {
+		t.Fatalf("failed to create cipher: %v", err)
+	}
+
+	padLen := aes.BlockSize - len(der)%aes.BlockSize
+	for i := 0; i < padLen; i++ {
+		der = append(der, byte(padLen))
+	}
+	encrypted := make([]byte, len(der))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, der)
+
+	mustMarshal := func(v any) []byte {
+		b, err := asn1.Marshal(v)
+		if err != nil {
+			t.Fatalf("failed to marshal ASN.1: %v", err)
+		}
+		return b
+	}
+
+	kdfParams := mustMarshal(struct {
+		Salt           []byte
+		IterationCount int
+		PRF            pkix.AlgorithmIdentifier
+	}{salt, 2048, pkix.AlgorithmIdentifier{
+		Algorithm:  asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9},
+		Parameters: asn1.NullRawValue,
+	}})
+
+	pbes2Params := mustMarshal(struct {
+		KeyDerivationFunc pkix.AlgorithmIdentifier
+		EncryptionScheme  pkix.AlgorithmIdentifier
+	}{
+		pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}, Parameters: asn1.RawValue{FullBytes: kdfParams}},
+		pkix.AlgorithmIdentifier{Algorithm: cipherOID, Parameters: asn1.RawValue{FullBytes: mustMarshal(iv)}},
+	})
+
+	encryptedPKCS8 := mustMarshal(struct {
+		Algorithm     pkix.AlgorithmIdentifier
+		EncryptedData []byte
+	}{
+		pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}, Parameters: asn1.RawValue{FullBytes: pbes2Params}},
+		encrypted,
+	})
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: encryptedPKCS8}))
+}
+
+func TestClauseBuilders_Limit(t *testing.T) {
+	tests := []struct {
+		name       string
+		fetchFirst bool
+		orderPages bool
+		query      func(db *gorm.DB) *gorm.DB
+		want       string
+	}{
+		{
+			name:  "limit",
+			query: func(db *gorm.DB) *gorm.DB { return db.Limit(10) },
+			want:  "SELECT * FROM USERS LIMIT 10",
+		},
+		{
+			name:  "limit and offset",
+			query: func(db *gorm.DB) *gorm.DB { return db.Limit(10).Offset(20) },
+			want:  "SELECT * FROM USERS LIMIT 10 OFFSET 20",
+		},
+		{
+			name:  "offset without limit",
+			query: func(db *gorm.DB) *gorm.DB { return db.Offset(20) },
+			want:  "SELECT * FROM USERS LIMIT NULL OFFSET 20",
+		},
+		{
+			name:       "fetch first",
+			fetchFirst: true,
+			query:      func(db *gorm.DB) *gorm.DB { return db.Limit(10).Offset(20) },
+			want:       "SELECT * FROM USERS OFFSET 20 ROWS FETCH FIRST 10 ROWS ONLY",
+		},
+		{
+			name:       "fetch first without offset",
+			fetchFirst: true,
+			query:      func(db *gorm.DB) *gorm.DB { return db.Limit(10) },
+			want:       "SELECT * FROM USERS FETCH FIRST 10 ROWS ONLY",
+		},
+		{
+			name:       "fetch first offset without limit",
+			fetchFirst: true,
+			query:      func(db *gorm.DB) *gorm.DB { return db.Offset(5) },
+			want:       "SELECT * FROM USERS OFFSET 5 ROWS FETCH FIRST NULL ROWS ONLY",
+		},
+		{
+			name:       "orders pages by primary key",
+			orderPages: true,
+			query:      func(db *gorm.DB) *gorm.DB { return db.Limit(10).Offset(20) },
+			want:       "SELECT * FROM USERS ORDER BY USERS.ID LIMIT 10 OFFSET 20",
+		},
+		{
+			name:       "keeps explicit order",
+			orderPages: true,
+			query:      func(db *gorm.DB) *gorm.DB { return db.Order("name").Limit(10) },
+			want:       "SELECT * FROM USERS ORDER BY name LIMIT 10",
+		},
+		{
+			name:       "does not order grouped pages",
+			orderPages: true,
+			query:      func(db *gorm.DB) *gorm.DB { return db.Select("name").Group("name").Limit(10) },
+			want:       "SELECT name FROM USERS GROUP BY NAME LIMIT 10",
+		},
+		{
+			name:       "no limit",
+			orderPages: true,
+			query:      func(db *gorm.DB) *gorm.DB { return db.Limit(-1) },
+			want:       "SELECT * FROM USERS",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dialector := snowflake.Offline()
+			dialector.FetchFirst = tt.fetchFirst
+			dialector.OrderPagesByPrimaryKey = tt.orderPages
+
+			db, err := gorm.Open(dialector, &gorm.Config{})
+			if err != nil {
+				t.Fatalf("failed to open offline dialector: %v", err)
+			}
+
+			var users []User
+			if err := tt.query(db.Model(&User{})).Find(&users).Error; err != nil {
+				t.Fatalf("query failed: %v", err)
+			}
+
+			if got := strings.TrimSpace(strings.TrimSuffix(dialector.SQL(), ";\n")); got != tt.want {
+				t.Errorf("SQL = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuoteTo(t *testing.T) {
+	tests := []struct {
+		name          string
+		caseSensitive bool
+		identifier    string
+		want          string
+	}{
+		{"uppercases valid names", false, "users", "USERS"},
+		{"splits dotted names", false, "users.id", "USERS.ID"},
+		{"quotes invalid names", false, "order items", `"ORDER ITEMS"`},
+		{"escapes embedded quotes", false, `a"b`, `"A""B"`},
+		{"keeps quoted names", false, `"OrderItems"`, `"OrderItems"`},
+		{"keeps dots inside quotes", false, `"a.b".c`, `"a.b".C`},
+		{"keeps star", false, "users.*", "USERS.*"},
+		{"quotes reserved keywords", false, "order", `"ORDER"`},
+		{"quotes reserved keywords in dotted names", false, "group.table", `"GROUP"."TABLE"`},
+		{"keeps non-reserved keywords", false, "comment", "COMMENT"},
+		{"case-sensitive quotes everything", true, "OrderItems", `"OrderItems"`},
+		{"case-sensitive dotted names", true, "OrderItems.Qty", `"OrderItems"."Qty"`},
+		{"case-sensitive escapes quotes", true, `My "Table"`, `"My ""Table"""`},
+		{"case-sensitive keeps quoted names", true, `"ORDER"`, `"ORDER"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dialector := snowflake.Dialector{Config: &snowflake.Config{CaseSensitiveIdentifiers: tt.caseSensitive}}
+
+			var sql strings.Builder
+			dialector.QuoteTo(&sql, tt.identifier)
+			if sql.String() != tt.want {
+				t.Errorf("QuoteTo(%q) = %s, want %s", tt.identifier, sql.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestCaseSensitiveIdentifiers_RendersQuotedStatements(t *testing.T) {
+	dialector := snowflake.Offline()
+	dialector.CaseSensitiveIdentifiers = true
+
+	db, err := gorm.Open(dialector, &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open offline dialector: %v", err)
+	}
+
+	if err := db.Table("OrderItems").Where("ID = ?", 1).Update("Quantity", 2).Error; err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+
+	want := `UPDATE "OrderItems" SET "Quantity"=2 WHERE ID = 1;` + "\n"
+	if got := dialector.SQL(); got != want {
+		t.Errorf("SQL = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,105 @@
+package snowflake
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/snowflakedb/gosnowflake"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidToken         = errors.New("invalid token: token cannot be empty")
+	ErrMissingTokenProvider = errors.New("invalid token provider: token provider cannot be nil")
+	ErrTokenExpired         = errors.New("token expired: token provider returned an expired token")
+	ErrTokenProviderFailed  = errors.New("token provider failed")
+)
+
+// TokenProvider supplies OAuth access tokens or programmatic access tokens. It is called for every new physical
+// connection, a provider that fetches tokens remotely should cache them until they are close to expiring. A zero
+// expiresAt means the expiry is unknown.
+type TokenProvider interface {
+	Token(ctx context.Context) (token string, expiresAt time.Time, err error)
+}
+
+// TokenProviderFunc adapts a callback to TokenProvider
+type TokenProviderFunc func(ctx context.Context) (string, time.Time, error)
+
+func (f TokenProviderFunc) Token(ctx context.Context) (string, time.Time, error) {
+	return f(ctx)
+}
+
+// StaticToken is a TokenProvider for a token that is managed elsewhere, e.g. a PAT from a secret store
+func StaticToken(token string) TokenProvider {
+	return TokenProviderFunc(func(ctx context.Context) (string, time.Time, error) {
+		return token, time.Time{}, nil
+	})
+}
+
+// OpenWithOAuth creates a dialector authenticating with OAuth access tokens from provider
+func OpenWithOAuth(account, user string, provider TokenProvider, database, schema, warehouse, role string) (gorm.Dialector, error) {
+	return OpenWithOptions(
+		WithAccount(account),
+		WithUser(user),
+		WithOAuth(provider),
+		WithDatabase(database),
+		WithSchema(schema),
+		WithDefaultWarehouse(warehouse),
+		WithDefaultRole(role),
+	)
+}
+
+// OpenWithPAT creates a dialector authenticating with Snowflake programmatic access tokens from provider
+func OpenWithPAT(account, user string, provider TokenProvider, database, schema, warehouse, role string) (gorm.Dialector, error) {
+	return OpenWithOptions(
+		WithAccount(account),
+		WithUser(user),
+		WithPAT(provider),
+		WithDatabase(database),
+		WithSchema(schema),
+		WithDefaultWarehouse(warehouse),
+		WithDefaultRole(role),
+	)
+}
+
+// tokenConnector asks the TokenProvider for a token before opening a physical connection
+type tokenConnector struct {
+	driver   gosnowflake.InternalSnowflakeDriver
+	config   gosnowflake.Config
+	provider TokenProvider
+}
+
+func (c *tokenConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	token, err := c.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	config := c.config
+	config.Token = token
+	return gosnowflake.NewConnector(c.driver, config).Connect(ctx)
+}
+
+func (c *tokenConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+func (c *tokenConnector) resolve(ctx context.Context) (string, error) {
+	token, expiresAt, err := c.provider.Token(ctx)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrTokenProviderFailed, err)
+	}
+
+	if strings.TrimSpace(token) == "" {
+		return "", fmt.Errorf("%w: token provider returned an empty token", ErrInvalidToken)
+	}
+
+	if !expiresAt.IsZero() && !time.Now().Before(expiresAt) {
+		return "", fmt.Errorf("%w: token expired at %s", ErrTokenExpired, expiresAt.Format(time.RFC3339))
+	}
+	return token, nil
+}
@@ -0,0 +1,179 @@
+package snowflake_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/snowflakedb/gosnowflake"
+	"github.com/stretchr/testify/require"
+	snowflake "github.com/vonix/gorm-snowflake"
+)
+
+func openWithTokens(t *testing.T, d *fakeDriver, auth func(snowflake.TokenProvider) snowflake.Option, provider snowflake.TokenProvider) *snowflake.Dialector {
+	t.Helper()
+
+	dialector, err := snowflake.OpenWithOptions(
+		snowflake.WithAccount("test-account"),
+		snowflake.WithUser("test-user"),
+		snowflake.WithDatabase("test-database"),
+		auth(provider),
+		snowflake.WithDriver(d),
+	)
+	require.NoError(t, err)
+	return dialector.(*snowflake.Dialector)
+}
+
+func TestOpenWithOAuth(t *testing.T) {
+	dialector, err := snowflake.OpenWithOAuth(
+		"test-account",
+		"test-user",
+		snowflake.StaticToken("access-token"),
+		"test-database",
+		"test-schema",
+		"test-warehouse",
+		"test-role",
+	)
+	require.NoError(t, err)
+	require.NotNil(t, dialector.(*snowflake.Dialector).Connector)
+
+	d := &fakeDriver{}
+	_, err = openWithTokens(t, d, snowflake.WithOAuth, snowflake.StaticToken("access-token")).Connector.Connect(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, gosnowflake.AuthTypeOAuth, d.lastConfig().Authenticator)
+	require.Equal(t, "access-token", d.lastConfig().Token)
+}
+
+func TestOpenWithPAT(t *testing.T) {
+	_, err := snowflake.OpenWithPAT(
+		"test-account",
+		"test-user",
+		snowflake.StaticToken("pat-secret"),
+		"test-database",
+		"test-schema",
+		"test-warehouse",
+		"test-role",
+	)
+	require.NoError(t, err)
+
+	d := &fakeDriver{}
+	_, err = openWithTokens(t, d, snowflake.WithPAT, snowflake.StaticToken("pat-secret")).Connector.Connect(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, gosnowflake.AuthTypePat, d.lastConfig().Authenticator)
+	require.Equal(t, "pat-secret", d.lastConfig().Token)
+}
+
+func TestOpenWithOAuth_Validation(t *testing.T) {
+	testCases := []struct {
+		name        string
+		account     string
+		user        string
+		provider    snowflake.TokenProvider
+		expectedErr error
+	}{
+		{
+			name:        "missing account",
+			account:     "",
+			user:        "test-user",
+			provider:    snowflake.StaticToken("access-token"),
+			expectedErr: snowflake.ErrInvalidAccount,
+		},
+		{
+			name:        "missing user",
+			account:     "test-account",
+			user:        "   ",
+			provider:    snowflake.StaticToken("access-token"),
+			expectedErr: snowflake.ErrInvalidUser,
+		},
+		{
+			name:        "missing provider",
+			account:     "test-account",
+			user:        "test-user",
+			provider:    nil,
+			expectedErr: snowflake.ErrMissingTokenProvider,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := snowflake.OpenWithOAuth(tc.account, tc.user, tc.provider, "test-database", "", "", "")
+			if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("expected error %v, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestTokenProvider_CalledPerConnection(t *testing.T) {
+	testCases := []struct {
+		name      string
+		expiresIn time.Duration
+	}{
+		{name: "valid for an hour", expiresIn: time.Hour},
+		{name: "unknown expiry"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+
+			d := &fakeDriver{}
+			connector := openWithTokens(t, d, snowflake.WithOAuth, snowflake.TokenProviderFunc(func(ctx context.Context) (string, time.Time, error) {
+				calls++
+				var expiresAt time.Time
+				if tc.expiresIn != 0 {
+					expiresAt = time.Now().Add(tc.expiresIn)
+				}
+				return fmt.Sprintf("token-%d", calls), expiresAt, nil
+			})).Connector
+
+			for i := 0; i < 3; i++ {
+				_, err := connector.Connect(context.Background())
+				require.NoError(t, err)
+			}
+			require.Equal(t, 3, calls)
+			require.Equal(t, "token-3", d.lastConfig().Token)
+		})
+	}
+}
+
+func TestTokenProvider_Errors(t *testing.T) {
+	testCases := []struct {
+		name        string
+		provider    snowflake.TokenProviderFunc
+		expectedErr error
+	}{
+		{
+			name: "empty token",
+			provider: func(ctx context.Context) (string, time.Time, error) {
+				return " ", time.Time{}, nil
+			},
+			expectedErr: snowflake.ErrInvalidToken,
+		},
+		{
+			name: "expired token",
+			provider: func(ctx context.Context) (string, time.Time, error) {
+				return "access-token", time.Now().Add(-time.Minute), nil
+			},
+			expectedErr: snowflake.ErrTokenExpired,
+		},
+		{
+			name: "provider failure",
+			provider: func(ctx context.Context) (string, time.Time, error) {
+				return "", time.Time{}, errors.New("identity provider unavailable")
+			},
+			expectedErr: snowflake.ErrTokenProviderFailed,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := &fakeDriver{}
+			_, err := openWithTokens(t, d, snowflake.WithOAuth, tc.provider).Connector.Connect(context.Background())
+			require.ErrorIs(t, err, tc.expectedErr)
+			require.Empty(t, d.configs)
+		})
+	}
+}
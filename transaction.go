@@ -0,0 +1,141 @@
+package snowflake
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNestedTransaction       = errors.New("nested transactions are not supported by Snowflake")
+	ErrTransactionRollbackOnly = errors.New("transaction is rollback-only after a nested transaction failed")
+)
+
+// SavePoint is called by gorm when a transaction is started inside another one. Snowflake has no savepoints, so
+// unless RollbackOnlyNestedTransactions is set the nested transaction is rejected before it runs.
+func (dialector Dialector) SavePoint(tx *gorm.DB, name string) error {
+	nested, ok := nestedTxOf(tx.Statement.ConnPool)
+	if !ok || !dialector.RollbackOnlyNestedTransactions {
+		return fmt.Errorf("%w: run the statements on the outer transaction or set RollbackOnlyNestedTransactions", ErrNestedTransaction)
+	}
+
+	nested.enter()
+	return nil
+}
+
+// RollbackTo is called by gorm when a nested transaction fails. Nothing can be undone on its own, the outer
+// transaction is marked rollback-only and the returned error says so.
+func (dialector Dialector) RollbackTo(tx *gorm.DB, name string) error {
+	nested, ok := nestedTxOf(tx.Statement.ConnPool)
+	if !ok || !dialector.RollbackOnlyNestedTransactions {
+		return fmt.Errorf("%w: cannot roll back to %s", ErrNestedTransaction, name)
+	}
+
+	return nested.fail()
+}
+
+// nestedTxOf returns the outer transaction a statement runs in, prepared statement mode wraps it in a PreparedStmtTX
+func nestedTxOf(pool gorm.ConnPool) (*nestedTx, bool) {
+	if prepared, ok := pool.(*gorm.PreparedStmtTX); ok {
+		pool = prepared.Tx
+	}
+	nested, ok := pool.(*nestedTx)
+	return nested, ok
+}
+
+// nestedTxConnPool hands out transactions that keep track of the nested transactions run inside them
+type nestedTxConnPool struct {
+	gorm.ConnPool
+}
+
+func (p *nestedTxConnPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	var (
+		tx  gorm.ConnPool
+		err error
+	)
+
+	switch beginner := p.ConnPool.(type) {
+	case gorm.TxBeginner:
+		tx, err = beginner.BeginTx(ctx, opts)
+	case gorm.ConnPoolBeginner:
+		tx, err = beginner.BeginTx(ctx, opts)
+	default:
+		return nil, gorm.ErrInvalidTransaction
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	committer, ok := tx.(gorm.TxCommitter)
+	if !ok {
+		return nil, gorm.ErrInvalidTransaction
+	}
+	return &nestedTx{ConnPool: tx, committer: committer}, nil
+}
+
+func (p *nestedTxConnPool) GetDBConn() (*sql.DB, error) {
+	return getDBConn(p.ConnPool)
+}
+
+func (p *nestedTxConnPool) Ping() error {
+	return ping(p.ConnPool)
+}
+
+// nestedTx is an outer transaction. gorm does not report when a nested transaction succeeds, so nested counts the
+// nested transactions started rather than the ones still running.
+type nestedTx struct {
+	gorm.ConnPool
+	committer gorm.TxCommitter
+
+	mu     sync.Mutex
+	nested int
+	failed int
+}
+
+func (tx *nestedTx) enter() {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	tx.nested++
+}
+
+func (tx *nestedTx) fail() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	tx.failed++
+	return fmt.Errorf("%w: the failed nested transaction is only undone when the outer transaction rolls back", ErrTransactionRollbackOnly)
+}
+
+// Commit rolls back instead when a nested transaction failed
+func (tx *nestedTx) Commit() error {
+	tx.mu.Lock()
+	nested, failed := tx.nested, tx.failed
+	tx.mu.Unlock()
+
+	if failed == 0 {
+		return tx.committer.Commit()
+	}
+
+	err := fmt.Errorf("%w: %d of %d nested transactions failed, rolled back instead of committing", ErrTransactionRollbackOnly, failed, nested)
+	if rollbackErr := tx.committer.Rollback(); rollbackErr != nil {
+		return errors.Join(err, rollbackErr)
+	}
+	return err
+}
+
+func (tx *nestedTx) Rollback() error {
+	return tx.committer.Rollback()
+}
+
+// StmtContext lets gorm's prepared statement mode use the transaction
+func (tx *nestedTx) StmtContext(ctx context.Context, stmt *sql.Stmt) *sql.Stmt {
+	if stmtTx, ok := tx.ConnPool.(interface {
+		StmtContext(ctx context.Context, stmt *sql.Stmt) *sql.Stmt
+	}); ok {
+		return stmtTx.StmtContext(ctx, stmt)
+	}
+	return stmt
+}
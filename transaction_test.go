@@ -0,0 +1,116 @@
+package snowflake_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+	snowflake "github.com/vonix/gorm-snowflake"
+	"gorm.io/gorm"
+)
+
+func TestTransaction_RejectsNestedTransactions(t *testing.T) {
+	db, mock := openMock(t, snowflake.Config{}, &gorm.Config{SkipDefaultTransaction: true})
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM USERS WHERE ID = 1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectRollback()
+
+	innerRan := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM USERS WHERE ID = 1").Error; err != nil {
+			return err
+		}
+		return tx.Transaction(func(tx *gorm.DB) error {
+			innerRan = true
+			return nil
+		})
+	})
+
+	require.ErrorIs(t, err, snowflake.ErrNestedTransaction)
+	require.False(t, innerRan)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTransaction_FailedNestedTransactionRollsBackOuter(t *testing.T) {
+	db, mock := openMock(t, snowflake.Config{RollbackOnlyNestedTransactions: true}, &gorm.Config{SkipDefaultTransaction: true})
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM USERS WHERE ID = 1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM USERS WHERE ID = 2").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectRollback()
+
+	innerErr := errors.New("inner failed")
+	var nestedErr error
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM USERS WHERE ID = 1").Error; err != nil {
+			return err
+		}
+		nestedErr = tx.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec("DELETE FROM USERS WHERE ID = 2").Error; err != nil {
+				return err
+			}
+			return innerErr
+		})
+		// the caller ignores the failure and tries to commit anyway
+		return nil
+	})
+
+	require.ErrorIs(t, nestedErr, innerErr)
+	require.ErrorIs(t, err, snowflake.ErrTransactionRollbackOnly)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTransaction_CommitsSucceedingNestedTransactions(t *testing.T) {
+	db, mock := openMock(t, snowflake.Config{RollbackOnlyNestedTransactions: true}, &gorm.Config{SkipDefaultTransaction: true})
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM USERS WHERE ID = 1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM USERS WHERE ID = 2").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM USERS WHERE ID = 1").Error; err != nil {
+			return err
+		}
+		return tx.Transaction(func(tx *gorm.DB) error {
+			return tx.Exec("DELETE FROM USERS WHERE ID = 2").Error
+		})
+	})
+
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	_, err = db.DB()
+	require.NoError(t, err)
+}
+
+func TestTransaction_NestedTransactionsWithPreparedStatements(t *testing.T) {
+	db, mock := openMock(t, snowflake.Config{RollbackOnlyNestedTransactions: true}, &gorm.Config{SkipDefaultTransaction: true})
+	db = db.Session(&gorm.Session{PrepareStmt: true})
+
+	mock.ExpectBegin()
+	for _, query := range []string{"DELETE FROM USERS WHERE ID = 1", "DELETE FROM USERS WHERE ID = 2"} {
+		// prepared on the pool, then again on the transaction's connection
+		mock.ExpectPrepare(query)
+		mock.ExpectPrepare(query).ExpectExec().WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectRollback()
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM USERS WHERE ID = 1").Error; err != nil {
+			return err
+		}
+		_ = tx.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec("DELETE FROM USERS WHERE ID = 2").Error; err != nil {
+				return err
+			}
+			return errors.New("inner failed")
+		})
+		return nil
+	})
+
+	require.ErrorIs(t, err, snowflake.ErrTransactionRollbackOnly)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
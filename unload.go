@@ -0,0 +1,218 @@
+package snowflake
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/snowflakedb/gosnowflake"
+	"gorm.io/gorm"
+)
+
+var ErrUnload = errors.New("unload failed")
+
+// UnloadFormat is the file format Unload exports the rows in
+type UnloadFormat int
+
+const (
+	// UnloadCSV exports CSV files, the default
+	UnloadCSV UnloadFormat = iota
+	// UnloadJSON exports newline delimited JSON, one object per row
+	UnloadJSON
+	// UnloadParquet exports Parquet files
+	UnloadParquet
+)
+
+// UnloadOptions configure Unload
+type UnloadOptions struct {
+	Format UnloadFormat
+	// Compression is the COMPRESSION of the files, e.g. GZIP, ZSTD or NONE for CSV and JSON, SNAPPY or NONE for
+	// Parquet. Snowflake's default is GZIP and SNAPPY.
+	Compression string
+	// Header writes the column names, the header line of CSV files and the column names of Parquet files,
+	// which are _COL_0, _COL_1, ... otherwise
+	Header bool
+	// Path is the directory on the user stage the files are exported to, a new one for every unload by default
+	Path string
+}
+
+// UnloadedFile is a file exported by Unload
+type UnloadedFile struct {
+	Name string
+	Rows int64
+	Size int64
+}
+
+var compressionOption = regexp.MustCompile(`^[A-Za-z_0-9]+$`)
+
+// Unload exports the rows of a query with COPY INTO the user stage and downloads the files with GET, which is much
+// faster than paging through them with Find:
+//
+//	var out bytes.Buffer
+//	files, err := snowflake.Unload(db.Model(&Event{}).Where("created_at >= ?", since), &out, snowflake.UnloadOptions{Header: true})
+//
+// dest is an io.Writer, which receives a single file, or the name of a directory, which receives the files the export
+// was split into. The staged files are removed afterwards.
+func Unload(db *gorm.DB, dest interface{}, opts UnloadOptions) (files []UnloadedFile, err error) {
+	if opts.Format != UnloadCSV && opts.Format != UnloadJSON && opts.Format != UnloadParquet {
+		return nil, fmt.Errorf("%w: unknown format %d", ErrUnload, opts.Format)
+	}
+	if opts.Compression != "" && !compressionOption.MatchString(opts.Compression) {
+		return nil, fmt.Errorf("%w: invalid COMPRESSION %q", ErrUnload, opts.Compression)
+	}
+	opts.Path = strings.Trim(opts.Path, "/")
+	if opts.Path == "" {
+		opts.Path = "unload/" + time.Now().UTC().Format("20060102T150405") + "_" + randomSuffix()
+	}
+	location := stringLiteral("@~/" + opts.Path + "/")
+
+	var (
+		writer, single = dest.(io.Writer)
+		local          string
+	)
+	if !single {
+		dir, ok := dest.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: dest must be an io.Writer or a directory, got %T", ErrUnload, dest)
+		}
+		abs, err := filepath.Abs(dir)
+		if err == nil {
+			err = os.MkdirAll(abs, 0o755)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrUnload, err)
+		}
+		local = abs
+	}
+
+	query, err := unloadQuery(db)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Session(&gorm.Session{NewDB: true}).Raw(unloadSQL(location, query, opts, single)).Rows()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnload, err)
+	}
+	// the staged files are removed whether or not the download succeeds
+	defer func() {
+		if removeErr := db.Session(&gorm.Session{NewDB: true}).Exec("REMOVE " + location).Error; removeErr != nil {
+			err = errors.Join(err, fmt.Errorf("%w: removing %s: %w", ErrUnload, location, removeErr))
+		}
+	}()
+
+	files, err = scanUnloadedFiles(rows)
+	rows.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnload, err)
+	}
+
+	if len(files) > 0 {
+		session := db.Session(&gorm.Session{NewDB: true})
+		if single {
+			// the file is written to the stream, the local directory is not used
+			local = os.TempDir()
+			session = session.WithContext(gosnowflake.WithFileGetStream(db.Statement.Context, writer))
+		}
+		if err := session.Exec("GET " + location + " " + stringLiteral("file://"+filepath.ToSlash(local)+"/")).Error; err != nil {
+			return nil, fmt.Errorf("%w: downloading %s: %w", ErrUnload, location, err)
+		}
+		if !single {
+			for i := range files {
+				files[i].Name = filepath.Join(local, filepath.Base(files[i].Name))
+			}
+		}
+	}
+	return files, nil
+}
+
+// unloadQuery renders the query db would run for Find with its variables inlined, COPY INTO takes no bind variables
+func unloadQuery(db *gorm.DB) (string, error) {
+	tx := db.Session(&gorm.Session{DryRun: true}).Find(&[]map[string]interface{}{})
+	if tx.Error != nil {
+		return "", fmt.Errorf("%w: %w", ErrUnload, tx.Error)
+	}
+
+	// unlike the logged SQL, a value without a literal must not be exported as its text
+	literals := make([]interface{}, len(tx.Statement.Vars))
+	for idx, value := range tx.Statement.Vars {
+		literal, err := inlineLiteral(value)
+		if err != nil {
+			return "", fmt.Errorf("%w: inlining variable %d: %w", ErrUnload, idx+1, err)
+		}
+		literals[idx] = explainedLiteral(literal)
+	}
+	return strings.TrimSuffix(strings.TrimSpace(explainRow(tx.Statement.SQL.String(), literals, -1)), ";"), nil
+}
+
+func unloadSQL(location, query string, opts UnloadOptions, single bool) string {
+	var sql strings.Builder
+	sql.WriteString("COPY INTO " + location + " FROM (")
+	if opts.Format == UnloadJSON {
+		// JSON files are unloaded from a single OBJECT column
+		sql.WriteString("SELECT OBJECT_CONSTRUCT(*) FROM (" + query + ")")
+	} else {
+		sql.WriteString(query)
+	}
+	sql.WriteString(") FILE_FORMAT = (TYPE = ")
+	switch opts.Format {
+	case UnloadCSV:
+		sql.WriteString(`CSV FIELD_OPTIONALLY_ENCLOSED_BY = '"'`)
+	case UnloadJSON:
+		sql.WriteString("JSON")
+	case UnloadParquet:
+		sql.WriteString("PARQUET")
+	}
+	if opts.Compression != "" {
+		sql.WriteString(" COMPRESSION = " + strings.ToUpper(opts.Compression))
+	}
+	sql.WriteString(")")
+	if opts.Header {
+		sql.WriteString(" HEADER = TRUE")
+	}
+	if single {
+		// a writer gets one file, the largest a single file can be is 5 GB
+		sql.WriteString(" SINGLE = TRUE MAX_FILE_SIZE = 5368709120")
+	}
+	sql.WriteString(" OVERWRITE = TRUE DETAILED_OUTPUT = TRUE")
+	return sql.String()
+}
+
+func scanUnloadedFiles(rows *sql.Rows) ([]UnloadedFile, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var files []UnloadedFile
+	for rows.Next() {
+		var (
+			name        sql.NullString
+			size, count sql.NullInt64
+			dest        = make([]interface{}, len(columns))
+		)
+		for idx, column := range columns {
+			switch strings.ToLower(column) {
+			case "file_name":
+				dest[idx] = &name
+			case "file_size":
+				dest[idx] = &size
+			case "row_count":
+				dest[idx] = &count
+			default:
+				dest[idx] = new(interface{})
+			}
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		files = append(files, UnloadedFile{Name: name.String, Rows: count.Int64, Size: size.Int64})
+	}
+	return files, rows.Err()
+}
@@ -0,0 +1,108 @@
+package snowflake_test
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+	snowflake "github.com/vonix/gorm-snowflake"
+	"gorm.io/gorm"
+)
+
+func TestUnload_StreamsSingleFile(t *testing.T) {
+	db, mock := openMock(t, snowflake.Config{}, &gorm.Config{SkipDefaultTransaction: true})
+
+	mock.ExpectQuery(`COPY INTO '@~/exports/ups/' FROM (SELECT * FROM SHIPMENTS WHERE carrier = 'ups') ` +
+		`FILE_FORMAT = (TYPE = CSV FIELD_OPTIONALLY_ENCLOSED_BY = '"' COMPRESSION = NONE) HEADER = TRUE ` +
+		`SINGLE = TRUE MAX_FILE_SIZE = 5368709120 OVERWRITE = TRUE DETAILED_OUTPUT = TRUE`).
+		WillReturnRows(sqlmock.NewRows([]string{"FILE_NAME", "FILE_SIZE", "ROW_COUNT"}).AddRow("data", 120, 3))
+	mock.ExpectExec("GET '@~/exports/ups/' 'file://" + filepath.ToSlash(os.TempDir()) + "/'").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("REMOVE '@~/exports/ups/'").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var out bytes.Buffer
+	files, err := snowflake.Unload(db.Model(&Shipment{}).Where("carrier = ?", "ups"), &out, snowflake.UnloadOptions{
+		Compression: "none",
+		Header:      true,
+		Path:        "exports/ups",
+	})
+	require.NoError(t, err)
+	require.Equal(t, []snowflake.UnloadedFile{{Name: "data", Rows: 3, Size: 120}}, files)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUnload_DownloadsFilesToDirectory(t *testing.T) {
+	db, mock := openMock(t, snowflake.Config{}, &gorm.Config{SkipDefaultTransaction: true})
+	dir := t.TempDir()
+
+	mock.ExpectQuery(`COPY INTO '@~/exports/all/' FROM (SELECT OBJECT_CONSTRUCT(*) FROM (SELECT * FROM SHIPMENTS)) ` +
+		`FILE_FORMAT = (TYPE = JSON) OVERWRITE = TRUE DETAILED_OUTPUT = TRUE`).
+		WillReturnRows(sqlmock.NewRows([]string{"FILE_NAME", "FILE_SIZE", "ROW_COUNT"}).
+			AddRow("data_0_0_0.json.gz", 2048, 500).
+			AddRow("data_0_1_0.json.gz", 1024, 250))
+	mock.ExpectExec("GET '@~/exports/all/' 'file://" + filepath.ToSlash(dir) + "/'").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("REMOVE '@~/exports/all/'").WillReturnResult(sqlmock.NewResult(0, 2))
+
+	files, err := snowflake.Unload(db.Model(&Shipment{}), dir, snowflake.UnloadOptions{Format: snowflake.UnloadJSON, Path: "exports/all"})
+	require.NoError(t, err)
+	require.Equal(t, []snowflake.UnloadedFile{
+		{Name: filepath.Join(dir, "data_0_0_0.json.gz"), Rows: 500, Size: 2048},
+		{Name: filepath.Join(dir, "data_0_1_0.json.gz"), Rows: 250, Size: 1024},
+	}, files)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUnload_RemovesFilesWhenDownloadFails(t *testing.T) {
+	db, mock := openMock(t, snowflake.Config{}, &gorm.Config{SkipDefaultTransaction: true})
+
+	mock.ExpectQuery(`COPY INTO '@~/exports/all/' FROM (SELECT * FROM SHIPMENTS) FILE_FORMAT = (TYPE = CSV FIELD_OPTIONALLY_ENCLOSED_BY = '"') ` +
+		`SINGLE = TRUE MAX_FILE_SIZE = 5368709120 OVERWRITE = TRUE DETAILED_OUTPUT = TRUE`).
+		WillReturnRows(sqlmock.NewRows([]string{"FILE_NAME", "FILE_SIZE", "ROW_COUNT"}).AddRow("data", 120, 3))
+	mock.ExpectExec("GET '@~/exports/all/' 'file://" + filepath.ToSlash(os.TempDir()) + "/'").
+		WillReturnError(errors.New("connection reset"))
+	mock.ExpectExec("REMOVE '@~/exports/all/'").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	_, err := snowflake.Unload(db.Model(&Shipment{}), &bytes.Buffer{}, snowflake.UnloadOptions{Path: "exports/all"})
+	require.ErrorIs(t, err, snowflake.ErrUnload)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+type unloadedNote struct{}
+
+func (unloadedNote) Value() (driver.Value, error) {
+	return nil, errors.New("note is not loaded")
+}
+
+func TestUnload_RejectsVariablesWithoutLiteral(t *testing.T) {
+	db, _ := openOffline(t)
+
+	_, err := snowflake.Unload(db.Model(&Shipment{}).Where("note = ?", unloadedNote{}), &bytes.Buffer{}, snowflake.UnloadOptions{})
+	require.ErrorIs(t, err, snowflake.ErrUnload)
+	require.ErrorContains(t, err, "note is not loaded")
+}
+
+func TestUnload_RejectsInvalidOptions(t *testing.T) {
+	db, _ := openOffline(t)
+
+	tests := []struct {
+		name string
+		dest interface{}
+		opts snowflake.UnloadOptions
+	}{
+		{name: "compression", dest: &bytes.Buffer{}, opts: snowflake.UnloadOptions{Compression: "GZIP) HEADER = (TRUE"}},
+		{name: "format", dest: &bytes.Buffer{}, opts: snowflake.UnloadOptions{Format: snowflake.UnloadFormat(9)}},
+		{name: "dest", dest: 42},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := snowflake.Unload(db.Model(&Shipment{}), tt.dest, tt.opts)
+			require.ErrorIs(t, err, snowflake.ErrUnload)
+		})
+	}
+}